@@ -7,13 +7,25 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
+var (
+	// ErrorUnreachable indicates rest_cherrypy did not respond to the connectivity check of WithConnectCheck
+	ErrorUnreachable = errors.New("rest_cherrypy is not reachable")
+)
+
+// connectCheckTimeout limits the connectivity check of WithConnectCheck
+const connectCheckTimeout = 5 * time.Second
+
 type RequestError struct {
 	StatusCode int
 	Status     string
@@ -34,7 +46,11 @@ type eauth struct {
 Client handles communication with NetAPI rest_cherrypy module (https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html)
 
 Example usage:
-	client := cherrypy.NewClient("http://master:8000", "admin", "password", "pam")
+	client, err := cherrypy.NewClient("http://master:8000", "admin", "password", "pam", false)
+	if err != nil {
+		return err
+	}
+
 	if err := client.Login(); err != nil {
 		return err
 	}
@@ -43,18 +59,39 @@ Example usage:
 	minion := client.Minion("minion1")
 */
 type Client struct {
-	client  *http.Client
-	eauth   *eauth
-	Address string
-	Token   string
+	client         *http.Client
+	insecureMu     sync.Mutex
+	insecureClient *http.Client
+	eauth          *eauth
+	formLogin      bool
+	legacyKwargs   bool
+	authObserver   func(AuthEvent)
+	requestMutator func(*http.Request) error
+	dryRun         bool
+	failFast       bool
+	checkFunctions bool
+	lateReturns    time.Duration
+	recorder       *cassettes
+	replay         *cassettes
+	connectCheck   bool
+	redirectPolicy func(*http.Request, []*http.Request) error
+	busMu          sync.Mutex
+	bus            *eventBus
+	tokenExpiry    time.Time
+	allowedTargets []string
+	Address        string
+	Token          string
 }
 
 /*
 NewClient creates a new instance of client
   address: URL of the cherrypy instance on a master (e.g.: https://salt-master:8000)
   backend: External authentication (eauth) backend (https://docs.saltstack.com/en/latest/topics/eauth/index.html)
+  opts: Optional behavior changes, see ClientOption
+
+Returns the first error reported by opts, or ErrorUnreachable if WithConnectCheck is set and the check fails.
 */
-func NewClient(address string, username string, password string, backend string, skipVerify bool) *Client {
+func NewClient(address string, username string, password string, backend string, skipVerify bool, opts ...ClientOption) (*Client, error) {
 	a := eauth{
 		Username: username,
 		Password: password,
@@ -67,16 +104,55 @@ func NewClient(address string, username string, password string, backend string,
 		},
 	}
 
-	return &Client{
+	c := &Client{
 		client:  &http.Client{Transport: tr},
 		eauth:   &a,
 		Address: address,
 	}
+	c.client.CheckRedirect = c.checkRedirect
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.connectCheck {
+		ctx, cancel := context.WithTimeout(context.Background(), connectCheckTimeout)
+		defer cancel()
+
+		if err := c.IsReady(ctx); err != nil {
+			return nil, fmt.Errorf("%s: %w: %s", address, ErrorUnreachable, err)
+		}
+	}
+
+	return c, nil
 }
 
-func (c *Client) newRequest(ctx context.Context, method string, endpoint string, body interface{}) (*http.Request, error) {
-	url := fmt.Sprintf("%s/%s", c.Address, endpoint)
+/*
+Close releases idle connections of the client, including those opened with WithInsecureSkipVerify(), and terminates the event stream shared by Subscribe()
+
+Channels of subscribers are closed; streams opened with Events() are terminated by their stop function instead.
+Session with rest_cherrypy is not terminated, see Logout(). Client can still be used after Close.
+*/
+func (c *Client) Close() {
+	c.busMu.Lock()
+	if c.bus != nil {
+		c.bus.cancel()
+		c.bus = nil
+	}
+	c.busMu.Unlock()
 
+	c.client.CloseIdleConnections()
+
+	c.insecureMu.Lock()
+	if c.insecureClient != nil {
+		c.insecureClient.CloseIdleConnections()
+	}
+	c.insecureMu.Unlock()
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, endpoint string, body interface{}) (*http.Request, error) {
 	var buf io.ReadWriter
 	if body != nil {
 		buf = &bytes.Buffer{}
@@ -88,14 +164,27 @@ func (c *Client) newRequest(ctx context.Context, method string, endpoint string,
 		}
 	}
 
-	log.Printf("[DEBUG] Creating request for %s", url)
-	req, err := http.NewRequestWithContext(ctx, method, url, buf)
+	return c.newRawRequest(ctx, method, endpoint, "application/json", buf)
+}
+
+// newRawRequest creates a request with an already encoded body
+func (c *Client) newRawRequest(ctx context.Context, method string, endpoint string, contentType string, body io.Reader) (*http.Request, error) {
+	url := fmt.Sprintf("%s/%s", c.Address, endpoint)
+
+	id, err := requestID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DEBUG] Creating request %s for %s", id, url)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 
+	req.Header.Set(requestIDHeader, id)
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
 	if c.Token != "" {
 		req.Header.Set("X-Auth-Token", c.Token)
 	}
@@ -104,15 +193,50 @@ func (c *Client) newRequest(ctx context.Context, method string, endpoint string,
 }
 
 func (c *Client) do(req *http.Request, v interface{}) (*http.Response, error) {
-	resp, err := c.client.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
 
-	log.Printf("[DEBUG] Received response %s from %s", resp.Status, resp.Request.URL)
+	if v != nil {
+		if w, ok := v.(io.Writer); ok {
+			if _, err = io.Copy(w, resp.Body); err != nil {
+				return nil, err
+			}
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(v)
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// send executes the request and checks the response status; the response body must be closed by the caller
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if c.requestMutator != nil {
+		if err := c.requestMutator(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.dryRun {
+		return dryRunResponse(req)
+	}
+
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DEBUG] Received response %s from %s for request %s", resp.Status, resp.Request.URL, req.Header.Get(requestIDHeader))
 	if resp.StatusCode > 299 || resp.StatusCode < 200 {
+		defer resp.Body.Close()
+
 		// Not checking for error as it does not matter
 		body, _ := ioutil.ReadAll(resp.Body)
 
@@ -123,16 +247,103 @@ func (c *Client) do(req *http.Request, v interface{}) (*http.Response, error) {
 		}
 	}
 
-	if v != nil {
-		if w, ok := v.(io.Writer); ok {
-			io.Copy(w, resp.Body)
-		} else {
-			err = json.NewDecoder(resp.Body).Decode(v)
-			if err != nil && err != io.EOF {
-				return nil, err
-			}
+	return resp, nil
+}
+
+// roundTrip sends the request, or replays its response with WithReplay
+func (c *Client) roundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if c.recorder != nil || c.replay != nil {
+		var err error
+		if body, err = requestBody(req); err != nil {
+			return nil, err
 		}
 	}
 
+	if c.replay != nil {
+		return c.replay.replay(req, body)
+	}
+
+	client := c.client
+	if insecureSkipVerify(req.Context()) {
+		client = c.insecureHTTPClient()
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.recorder != nil {
+		return c.recorder.record(req, body, resp)
+	}
+
 	return resp, nil
 }
+
+// insecureHTTPClient returns a client sharing the configuration of the client except for certificate verification
+func (c *Client) insecureHTTPClient() *http.Client {
+	c.insecureMu.Lock()
+	defer c.insecureMu.Unlock()
+
+	if c.insecureClient == nil {
+		tr := c.client.Transport.(*http.Transport).Clone()
+		tr.TLSClientConfig.InsecureSkipVerify = true
+
+		c.insecureClient = &http.Client{
+			Transport:     tr,
+			CheckRedirect: c.checkRedirect,
+		}
+	}
+
+	return c.insecureClient
+}
+
+// maxRedirects is the number of redirects followed unless a redirect policy is set, same as http.Client
+const maxRedirects = 10
+
+// checkRedirect removes the token from redirects to another origin and applies the redirect policy
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if req.URL.Scheme != via[0].URL.Scheme || req.URL.Host != via[0].URL.Host {
+		if insecureSkipVerify(req.Context()) {
+			return fmt.Errorf("refusing to follow redirect to %s without certificate verification", req.URL.Host)
+		}
+
+		req.Header.Del("X-Auth-Token")
+	}
+
+	if c.redirectPolicy != nil {
+		return c.redirectPolicy(req, via)
+	}
+
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	return nil
+}
+
+// dryRunReturn is the response body of requests in dry run mode; a single empty return
+const dryRunReturn = `{"return": [{}]}`
+
+// dryRunResponse logs the request and responds with dryRunReturn instead of sending it
+func dryRunResponse(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		defer req.Body.Close()
+
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("[INFO] Dry run of request %s: %s %s %s", req.Header.Get(requestIDHeader), req.Method, req.URL, redactPassword(body))
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(dryRunReturn)),
+		Request:    req,
+	}, nil
+}
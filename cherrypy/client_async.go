@@ -0,0 +1,109 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// followInterval is the interval of polling the returns of jobs followed with WithWait
+const followInterval = time.Second
+
+var (
+	// ErrorNotFollowed indicates Wait() was called on a job started without WithWait
+	ErrorNotFollowed = errors.New("job is not followed, see WithWait")
+)
+
+type runOptions struct {
+	wait time.Duration
+}
+
+// RunOption changes the behavior of Run
+type RunOption func(*runOptions)
+
+/*
+WithWait makes Run follow the job in the background for up to timeout, so that its returns can be awaited with Wait()
+
+Returns gathered when timeout expires are returned with Partial set, like RunJob does.
+*/
+func WithWait(timeout time.Duration) RunOption {
+	return func(o *runOptions) {
+		o.wait = timeout
+	}
+}
+
+// RunResult is a job started by Run
+type RunResult struct {
+	AsyncMinionJobResult
+
+	done   chan struct{}
+	result *MinionJobResult
+	err    error
+}
+
+/*
+Wait blocks until the returns of the job are collected or ctx expires
+
+Returns ErrorNotFollowed if the job was not started with WithWait, unless no minions matched its target.
+May be called several times and concurrently; the job is followed regardless of ctx.
+*/
+func (r *RunResult) Wait(ctx context.Context) (*MinionJobResult, error) {
+	if r.done == nil {
+		return nil, ErrorNotFollowed
+	}
+
+	select {
+	case <-r.done:
+		return r.result, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+/*
+Run submits the job asynchronously and returns its id as soon as Salt accepts it
+
+With WithWait, returns of the job are polled in the background and can be awaited with Wait();
+otherwise the job is fire-and-forget like SubmitJob. Following is not cancelled along with ctx,
+but keeps its values such as the request id.
+If no minions matched the target, the result has no id and Wait() returns an empty result right away.
+*/
+func (c *Client) Run(ctx context.Context, job MinionJob, opts ...RunOption) (*RunResult, error) {
+	var o runOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	res, err := c.SubmitJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil || res.ID == "" {
+		r := &RunResult{done: make(chan struct{}), result: &MinionJobResult{}}
+		if res != nil {
+			r.AsyncMinionJobResult = *res
+		}
+
+		close(r.done)
+		return r, nil
+	}
+
+	r := &RunResult{AsyncMinionJobResult: *res}
+	if o.wait <= 0 {
+		return r, nil
+	}
+
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		fctx, cancel := context.WithTimeout(detachedContext{ctx}, o.wait)
+		defer cancel()
+
+		r.result, r.err = c.collectJob(fctx, res, followInterval)
+	}()
+
+	return r, nil
+}
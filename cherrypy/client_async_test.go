@@ -0,0 +1,69 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunWithWait(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "single")
+	tester.Setup(t, "jobs_get", "complete")
+
+	r, err := c.Run(context.Background(), MinionJob{
+		Target:   ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function: "test.ping",
+	}, WithWait(time.Minute))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "20200202220915030498", r.ID)
+
+	res, err := r.Wait(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, true, res.Returns["minion1"])
+	assert.False(t, res.Partial)
+}
+
+func TestRunWithoutWait(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "single")
+
+	r, err := c.Run(context.Background(), MinionJob{
+		Target:   ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function: "test.ping",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "20200202220915030498", r.ID)
+
+	res, err := r.Wait(context.Background())
+
+	assert.True(t, errors.Is(err, ErrorNotFollowed))
+	assert.Nil(t, res)
+}
+
+func TestRunWithoutMatchedMinions(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "empty")
+
+	r, err := c.Run(context.Background(), MinionJob{
+		Target:   ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function: "test.ping",
+	})
+
+	assert.NoError(t, err)
+	assert.Empty(t, r.ID)
+
+	res, err := r.Wait(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, &MinionJobResult{}, res)
+}
@@ -2,19 +2,74 @@ package cherrypy
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
+// logoutTimeout limits how long Logout waits for rest_cherrypy to clear the session
+const logoutTimeout = 10 * time.Second
+
 var (
 	// ErrorInvalidCredentials indicates authentication failed with 401 error.
 	// Username, password or backend might be invalid.
 	ErrorInvalidCredentials = errors.New("invalid credentials or authentication backend: %s")
 
+	// ErrorEauthNotConfigured indicates authentication failed with 401 error because the master does not
+	// provide the authentication backend; the master configuration has to be fixed instead of the credentials.
+	// rest_cherrypy itself responds with the same generic 401 error as for invalid credentials, so this is only
+	// returned if a custom error page or a proxy in front of the master passes the error of Salt in the body.
+	ErrorEauthNotConfigured = errors.New("authentication backend is not configured on the master")
+
 	// ErrorNotAuthenticated indicates Logout() was called before authenticating with Salt
 	ErrorNotAuthenticated = errors.New("not authenticated")
+
+	// ErrorSessionExpired indicates an imported session has expired and Login() is required
+	ErrorSessionExpired = errors.New("session expired")
+
+	// ErrorSessionMismatch indicates an imported session was exported by a client of another master
+	ErrorSessionMismatch = errors.New("session belongs to another address")
+
+	// ErrorSessionExpiryUnknown indicates ExportSession() was called for a token which was not received by Login()
+	ErrorSessionExpiryUnknown = errors.New("expiry of the session is unknown")
 )
 
+/*
+AuthEventType indicates which step of authentication lifecycle an AuthEvent reports
+
+See the constants available in this file for possible values.
+*/
+type AuthEventType string
+
+const (
+	// AuthLoginAttempt is reported before a login request is sent
+	AuthLoginAttempt AuthEventType = "login_attempt"
+
+	// AuthLoginSuccess is reported when a token is received
+	AuthLoginSuccess = "login_success"
+
+	// AuthLoginFailure is reported when login fails, including rejected credentials
+	AuthLoginFailure = "login_failure"
+
+	// AuthLogout is reported when a session is terminated or termination failed
+	AuthLogout = "logout"
+)
+
+// AuthEvent is reported to the observer set with WithAuthObserver
+type AuthEvent struct {
+	Type AuthEventType
+
+	// Err is set if the step failed
+	Err error
+}
+
 type loginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -22,78 +77,305 @@ type loginRequest struct {
 }
 
 type loginData struct {
-	// TODO: Not sure about the data structure of permissions
-	//	Permissions []string `json:"perms"`
-	StartTime  saltUnixTime `json:"start"`
-	Token      string       `json:"token"`
-	ExpireTime saltUnixTime `json:"expire"`
-	User       string       `json:"user"`
-	Backend    string       `json:"eauth"`
+	Permissions permissions  `json:"perms"`
+	StartTime   saltUnixTime `json:"start"`
+	Token       string       `json:"token"`
+	ExpireTime  saltUnixTime `json:"expire"`
+	User        string       `json:"user"`
+	Backend     string       `json:"eauth"`
+}
+
+/*
+permissions collects the targets of eauth permissions returned on login
+
+Permissions are a list of function patterns allowed on all minions, patterns of other clients (e.g.: @runner)
+and dicts of target expressions to function patterns, or a single such dict.
+*/
+type permissions struct {
+	Targets []string
+}
+
+func (p *permissions) UnmarshalJSON(b []byte) error {
+	var perms []interface{}
+	if err := json.Unmarshal(b, &perms); err != nil {
+		var d map[string]interface{}
+		if json.Unmarshal(b, &d) != nil {
+			return err
+		}
+
+		perms = []interface{}{d}
+	}
+
+	seen := make(map[string]bool)
+	add := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			p.Targets = append(p.Targets, t)
+		}
+	}
+
+	for _, perm := range perms {
+		switch v := perm.(type) {
+		case string:
+			if !strings.HasPrefix(v, "@") {
+				add("*")
+			}
+		case map[string]interface{}:
+			targets := make([]string, 0, len(v))
+			for t := range v {
+				if !strings.HasPrefix(t, "@") {
+					targets = append(targets, t)
+				}
+			}
+
+			sort.Strings(targets)
+			for _, t := range targets {
+				add(t)
+			}
+		}
+	}
+
+	return nil
 }
 
 type loginResponse struct {
 	Return []loginData `json:"return"`
 }
 
+// session is the format of ExportSession
+type session struct {
+	Address string    `json:"address"`
+	Token   string    `json:"token"`
+	Expire  time.Time `json:"expire"`
+}
+
 /*
 Login establishes a session with rest_cherrypy and retrieves the token
 
 https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#login
 */
 func (c *Client) Login(ctx context.Context) error {
-	data := loginRequest{
-		Username: c.eauth.Username,
-		Password: c.eauth.Password,
-		Backend:  c.eauth.Backend,
+	data, err := c.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.Token = data.Token
+	c.tokenExpiry = data.ExpireTime.Time
+	c.allowedTargets = data.Permissions.Targets
+	log.Printf("[DEBUG] Received token %s", c.Token)
+
+	return nil
+}
+
+/*
+Logout terminates the session with rest_cherrypy and clears the token
+
+Calls to logout will fail with ErrorNotAuthenticated if Login() was not called prior.
+
+Logout is usually deferred and may run after ctx was cancelled; therefore cancellation
+and deadline of ctx are ignored and the request is limited by its own timeout instead.
+
+https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#logout
+*/
+func (c *Client) Logout(ctx context.Context) error {
+	if c.Token == "" {
+		return ErrorNotAuthenticated
+	}
+
+	if err := c.logout(ctx, c.Token); err != nil {
+		return err
+	}
+
+	c.Token = ""
+	c.tokenExpiry = time.Time{}
+	c.allowedTargets = nil
+	return nil
+}
+
+/*
+AllowedTargets returns the target expressions the eauth permissions of the user allow commands on
+
+Expressions are as configured for eauth (e.g.: minion1, web*, G@os:Ubuntu) and * if functions are
+allowed on all minions; they can be matched to minion ids with MatchTargets().
+Permissions are received by Login(); returns nil if the user is not allowed to target minions or
+before Login(), including sessions restored with ImportSession().
+*/
+func (c *Client) AllowedTargets() []string {
+	return c.allowedTargets
+}
+
+/*
+ExportSession serializes the token and its expiry, to be restored with ImportSession() e.g. after a restart
+
+The session grants access to the master like credentials do and should be stored accordingly.
+Returns ErrorNotAuthenticated if Login() was not called prior and ErrorSessionExpiryUnknown if the token
+was set directly instead, as its expiry is only received on login.
+*/
+func (c *Client) ExportSession() ([]byte, error) {
+	if c.Token == "" {
+		return nil, ErrorNotAuthenticated
+	}
+
+	if c.tokenExpiry.IsZero() {
+		return nil, ErrorSessionExpiryUnknown
+	}
+
+	return json.Marshal(session{
+		Address: c.Address,
+		Token:   c.Token,
+		Expire:  c.tokenExpiry,
+	})
+}
+
+/*
+ImportSession restores a session serialized with ExportSession() instead of calling Login()
+
+Returns ErrorSessionExpired if the token has expired and ErrorSessionMismatch if the session
+was exported for another address; the token of the client is not changed in either case.
+*/
+func (c *Client) ImportSession(b []byte) error {
+	var s session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("cannot decode session: %w", err)
+	}
+
+	if s.Address != c.Address {
+		return fmt.Errorf("%s: %w", s.Address, ErrorSessionMismatch)
 	}
 
-	req, err := c.newRequest(ctx, "POST", "login", data)
+	if s.Token == "" || !time.Now().Before(s.Expire) {
+		return fmt.Errorf("expired at %s: %w", s.Expire, ErrorSessionExpired)
+	}
+
+	c.Token = s.Token
+	c.tokenExpiry = s.Expire
+	return nil
+}
+
+/*
+VerifyCredentials checks the configured username, password and backend by logging in and out immediately
+
+Token of the client is not changed and no session is left behind on the master.
+Returns ErrorInvalidCredentials if Salt rejects the credentials or the backend,
+*RequestError if rest_cherrypy responds with another error
+and the transport error if the master cannot be reached.
+*/
+func (c *Client) VerifyCredentials(ctx context.Context) error {
+	data, err := c.login(ctx)
 	if err != nil {
 		return err
 	}
 
+	return c.logout(ctx, data.Token)
+}
+
+func (c *Client) login(ctx context.Context) (*loginData, error) {
+	c.notifyAuth(AuthLoginAttempt, nil)
+	data, err := c.sendLogin(ctx)
+	if err != nil {
+		c.notifyAuth(AuthLoginFailure, err)
+		return nil, err
+	}
+
+	c.notifyAuth(AuthLoginSuccess, nil)
+	return data, nil
+}
+
+func (c *Client) sendLogin(ctx context.Context) (*loginData, error) {
+	req, err := c.newLoginRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	log.Println("[DEBUG] Sending authentication request")
 	var response loginResponse
 	_, err = c.do(req, &response)
 	if err != nil {
 		if rerr, ok := err.(*RequestError); ok {
 			if rerr.StatusCode == 401 {
-				return ErrorInvalidCredentials
+				if hint, ok := eauthNotConfigured(rerr.Body); ok {
+					return nil, fmt.Errorf("%s: %w: %s", c.eauth.Backend, ErrorEauthNotConfigured, hint)
+				}
+
+				return nil, ErrorInvalidCredentials
 			}
 		}
 
-		return err
+		return nil, err
 	}
 
-	c.Token = response.Return[0].Token
-	log.Printf("[DEBUG] Received token %s", c.Token)
+	if len(response.Return) != 1 {
+		return nil, fmt.Errorf("expected 1 results but received %d", len(response.Return))
+	}
 
-	return nil
+	return &response.Return[0], nil
 }
 
-/*
-Logout terminates the session with rest_cherrypy and clears the token
+// eauthMarkers are messages of Salt's errors for an unavailable authentication backend; stock rest_cherrypy
+// does not include them in login errors, but custom error pages and proxies exposing the error of Salt might
+var eauthMarkers = []string{
+	"eauthauthenticationerror",
+	"unknown eauth",
+	"external authentication system",
+}
 
-Calls to logout will fail with ErrorNotAuthenticated if Login() was not called prior.
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
 
-https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#logout
-*/
-func (c *Client) Logout(ctx context.Context) error {
-	if c.Token == "" {
-		return ErrorNotAuthenticated
+// eauthNotConfigured looks for the error of an unavailable authentication backend in the body of a login error
+func eauthNotConfigured(body []byte) (string, bool) {
+	text := htmlTag.ReplaceAllString(string(body), "\n")
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		lower := strings.ToLower(line)
+		for _, m := range eauthMarkers {
+			if strings.Contains(lower, m) {
+				return line, true
+			}
+		}
 	}
 
+	return "", false
+}
+
+func (c *Client) newLoginRequest(ctx context.Context) (*http.Request, error) {
+	if c.formLogin {
+		form := url.Values{}
+		form.Set("username", c.eauth.Username)
+		form.Set("password", c.eauth.Password)
+		form.Set("eauth", c.eauth.Backend)
+
+		return c.newRawRequest(ctx, "POST", "login", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	}
+
+	data := loginRequest{
+		Username: c.eauth.Username,
+		Password: c.eauth.Password,
+		Backend:  c.eauth.Backend,
+	}
+
+	return c.newRequest(ctx, "POST", "login", data)
+}
+
+func (c *Client) logout(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, logoutTimeout)
+	defer cancel()
+
 	req, err := c.newRequest(ctx, "POST", "logout", nil)
 	if err != nil {
 		return err
 	}
 
+	req.Header.Set("X-Auth-Token", token)
+
 	log.Println("[DEBUG] Sending logout request")
 	_, err = c.do(req, nil)
-	if err != nil {
-		return err
-	}
+	c.notifyAuth(AuthLogout, err)
+	return err
+}
 
-	c.Token = ""
-	return nil
+func (c *Client) notifyAuth(t AuthEventType, err error) {
+	if c.authObserver != nil {
+		c.authObserver(AuthEvent{Type: t, Err: err})
+	}
 }
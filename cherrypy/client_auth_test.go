@@ -2,7 +2,9 @@ package cherrypy
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,6 +21,42 @@ func TestValidLogin(t *testing.T) {
 	assert.Equal(t, testToken, c.Token)
 }
 
+func TestAllowedTargets(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_login", "scoped_perms")
+
+	c.Token = ""
+	err := c.Login(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*", "G@os:Ubuntu", "web*", "minion1"}, c.AllowedTargets())
+}
+
+func TestAllowedTargetsWithoutPermissions(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_login", "success")
+
+	c.Token = ""
+	err := c.Login(context.Background())
+
+	assert.NoError(t, err)
+	assert.Nil(t, c.AllowedTargets())
+}
+
+func TestValidFormLogin(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_login", "form_success")
+
+	c := newClient(t, tester, WithFormLogin())
+	err := c.Login(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, testToken, c.Token)
+}
+
 func TestInvalidLogin(t *testing.T) {
 	tester, c := setup(t)
 	defer tester.Close()
@@ -27,10 +65,47 @@ func TestInvalidLogin(t *testing.T) {
 	c.Token = ""
 	err := c.Login(context.Background())
 
-	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrorInvalidCredentials))
 	assert.Equal(t, "", c.Token)
 }
 
+func TestLoginWithEauthNotConfigured(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_login", "eauth_error_body")
+
+	c.Token = ""
+	err := c.Login(context.Background())
+
+	assert.True(t, errors.Is(err, ErrorEauthNotConfigured))
+	assert.Contains(t, err.Error(), `The specified external authentication system "pam" is not available`)
+	assert.Empty(t, c.Token)
+}
+
+func TestVerifyCredentials(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_login", "success")
+	tester.Setup(t, "auth_logout", "success")
+
+	c.Token = ""
+	err := c.VerifyCredentials(context.Background())
+
+	assert.NoError(t, err)
+	assert.Empty(t, c.Token)
+}
+
+func TestVerifyInvalidCredentials(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_login", "bad_user")
+
+	err := c.VerifyCredentials(context.Background())
+
+	assert.True(t, errors.Is(err, ErrorInvalidCredentials))
+	assert.Equal(t, testToken, c.Token)
+}
+
 func TestLogout(t *testing.T) {
 	tester, c := setup(t)
 	defer tester.Close()
@@ -46,3 +121,111 @@ func TestLogout(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, c.Token)
 }
+
+func TestLogoutWithCancelledContext(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_logout", "success")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.Logout(ctx)
+
+	assert.NoError(t, err)
+	assert.Empty(t, c.Token)
+}
+
+func TestAuthObserver(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_login", "success")
+	tester.Setup(t, "auth_logout", "success")
+
+	var events []AuthEvent
+	c := newClient(t, tester, WithAuthObserver(func(e AuthEvent) {
+		events = append(events, e)
+	}))
+
+	assert.NoError(t, c.Login(context.Background()))
+	assert.NoError(t, c.Logout(context.Background()))
+
+	assert.Equal(t, []AuthEvent{
+		{Type: AuthLoginAttempt},
+		{Type: AuthLoginSuccess},
+		{Type: AuthLogout},
+	}, events)
+}
+
+func TestAuthObserverLoginFailure(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_login", "bad_user")
+
+	var events []AuthEvent
+	c := newClient(t, tester, WithAuthObserver(func(e AuthEvent) {
+		events = append(events, e)
+	}))
+
+	assert.Error(t, c.Login(context.Background()))
+
+	assert.Equal(t, []AuthEvent{
+		{Type: AuthLoginAttempt},
+		{Type: AuthLoginFailure, Err: ErrorInvalidCredentials},
+	}, events)
+}
+
+func TestExportSession(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "auth_login", "success")
+
+	c.Token = ""
+	assert.NoError(t, c.Login(context.Background()))
+
+	b, err := c.ExportSession()
+	assert.NoError(t, err)
+
+	// Token of the recorded login expired in 2020
+	r := newClient(t, tester)
+	err = r.ImportSession(b)
+
+	assert.True(t, errors.Is(err, ErrorSessionExpired))
+	assert.Empty(t, r.Token)
+}
+
+func TestImportSession(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	c.tokenExpiry = time.Now().Add(time.Hour)
+
+	b, err := c.ExportSession()
+	assert.NoError(t, err)
+
+	r := newClient(t, tester)
+	assert.NoError(t, r.ImportSession(b))
+	assert.Equal(t, testToken, r.Token)
+
+	r.Address = "https://another-master:8000"
+	r.Token = ""
+	assert.True(t, errors.Is(r.ImportSession(b), ErrorSessionMismatch))
+}
+
+func TestExportSessionWithoutExpiry(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+
+	b, err := c.ExportSession()
+
+	assert.True(t, errors.Is(err, ErrorSessionExpiryUnknown))
+	assert.Nil(t, b)
+}
+
+func TestExportSessionNotAuthenticated(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	c.Token = ""
+
+	_, err := c.ExportSession()
+
+	assert.True(t, errors.Is(err, ErrorNotAuthenticated))
+}
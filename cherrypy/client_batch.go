@@ -0,0 +1,110 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrorInvalidBatchSize indicates Batch.Size is neither a positive number nor a positive percentage
+	ErrorInvalidBatchSize = errors.New("invalid batch size, expected a number of minions or a percentage")
+)
+
+// Batch controls how Salt executes a job on minions in batches
+type Batch struct {
+	// Size is the number (e.g.: 10) or the percentage (e.g.: 25%) of targeted minions executing the job at once
+	Size string
+
+	// Wait is the time to wait after a batch completes before starting the next one
+	Wait time.Duration
+
+	// FailHard stops starting new batches once a minion fails the job
+	FailHard bool
+}
+
+/*
+RunJobInBatches executes the job on targeted minions in batches and waits for the returns of all batches
+
+Returns and retcodes of the minions are returned keyed by minion id; with WithFailFast, failures are
+reported like for the other local commands.
+
+https://docs.saltstack.com/en/latest/topics/targeting/batch.html
+*/
+func (c *Client) RunJobInBatches(ctx context.Context, job MinionJob, batch Batch) (*LocalResult, error) {
+	if err := validateBatchSize(batch.Size); err != nil {
+		return nil, err
+	}
+
+	d, err := c.prepareJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := Command{
+		Client:   LocalBatchClient,
+		Target:   job.Target,
+		Function: job.Function,
+		Timeout:  job.Timeout,
+		Arguments: map[string]interface{}{
+			"batch": batch.Size,
+		},
+	}
+
+	if d.RawArguments != nil {
+		cmd.Arguments["arg"] = d.RawArguments
+	} else if len(d.Arguments) > 0 {
+		cmd.Arguments["arg"] = d.Arguments
+	}
+
+	if d.RawKWArguments != nil {
+		cmd.Arguments["kwarg"] = d.RawKWArguments
+	} else if len(d.KWArguments) > 0 {
+		cmd.Arguments["kwarg"] = d.KWArguments
+	}
+
+	if batch.Wait > 0 {
+		cmd.Arguments["batch_wait"] = saltSeconds(batch.Wait)
+	}
+
+	if batch.FailHard {
+		cmd.Arguments["failhard"] = true
+	}
+
+	// each minion is returned as a separate result as its batch completes
+	var resp localResponse
+	if err := c.runCommands(ctx, []Command{cmd}, &resp); err != nil {
+		return nil, err
+	}
+
+	returns := make(map[string]localReturn)
+	for _, r := range resp.Return {
+		for m, ret := range r {
+			returns[m] = ret
+		}
+	}
+
+	if c.failFast {
+		if err := failedMinions(returns); err != nil {
+			return nil, err
+		}
+	}
+
+	return newLocalResult(returns)
+}
+
+// validateBatchSize checks size is a positive integer or a positive percentage, as Salt parses batch sizes
+func validateBatchSize(size string) error {
+	if strings.HasSuffix(size, "%") {
+		if p, err := strconv.ParseFloat(strings.TrimSuffix(size, "%"), 64); err == nil && p > 0 {
+			return nil
+		}
+	} else if n, err := strconv.Atoi(size); err == nil && n > 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%q: %w", size, ErrorInvalidBatchSize)
+}
@@ -0,0 +1,69 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunJobInBatches(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_batch_cmd_run")
+
+	job := MinionJob{
+		Target:    ExpressionTarget{Expression: "minion*", Type: Glob},
+		Function:  "cmd.run",
+		Arguments: []interface{}{"systemctl restart nginx"},
+	}
+
+	res, err := c.RunJobInBatches(context.Background(), job, Batch{Size: "50%", Wait: 1500 * time.Millisecond, FailHard: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"minion1": "", "minion2": ""}, res.Returns)
+	assert.Equal(t, 0, res.ExitCode())
+}
+
+func TestRunJobInBatchesWithTimeout(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_batch_cmd_run_timeout")
+
+	job := MinionJob{
+		Target:    ExpressionTarget{Expression: "minion*", Type: Glob},
+		Function:  "cmd.run",
+		Arguments: []interface{}{"systemctl restart nginx"},
+		Timeout:   2 * time.Minute,
+	}
+
+	res, err := c.RunJobInBatches(context.Background(), job, Batch{Size: "1"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"minion1": "", "minion2": ""}, res.Returns)
+}
+
+func TestRunJobInBatchesWithInvalidSize(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+
+	job := MinionJob{
+		Target:   ExpressionTarget{Expression: "minion*", Type: Glob},
+		Function: "test.ping",
+	}
+
+	for _, size := range []string{"", "0", "-1", "1.5", "ten", "%", "0%", "-10%", "10 %"} {
+		res, err := c.RunJobInBatches(context.Background(), job, Batch{Size: size})
+
+		assert.True(t, errors.Is(err, ErrorInvalidBatchSize), size)
+		assert.Nil(t, res)
+	}
+}
+
+func TestValidateBatchSize(t *testing.T) {
+	for _, size := range []string{"1", "10", "25%", "12.5%", "100%"} {
+		assert.NoError(t, validateBatchSize(size), size)
+	}
+}
@@ -0,0 +1,189 @@
+package cherrypy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrorNoRecording indicates WithReplay found no recorded response matching a request
+	ErrorNoRecording = errors.New("no recorded response for request")
+)
+
+// cassette is the format of a request and its response recorded by WithRecorder
+type cassette struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+type recordedRequest struct {
+	Method string `json:"method"`
+	URI    string `json:"uri"`
+	Body   string `json:"body,omitempty"`
+}
+
+// recordedResponse keeps the body as bytes, encoded to base64, as binary bodies such as tar archives are not valid strings
+type recordedResponse struct {
+	Status     string      `json:"status"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+/*
+cassettes stores recorded responses in a directory, in a file per request
+
+Requests are matched by method, URI and body with passwords redacted; repeated requests are numbered in order,
+so that e.g. polling a job replays its progress. Once the recordings of a request are exhausted, the last
+one is replayed again.
+
+Key pairs generated with POST /keys contain private keys and are never recorded; such requests are
+sent to the master when recording and fail with ErrorNoRecording when replaying.
+*/
+type cassettes struct {
+	dir    string
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newCassettes(dir string) *cassettes {
+	return &cassettes{dir: dir, counts: make(map[string]int)}
+}
+
+// record saves the response of the request and returns a copy of it with the body restored
+func (r *cassettes) record(req *http.Request, body []byte, resp *http.Response) (*http.Response, error) {
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") || generatesKeys(req) {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	key, reqData := requestKey(req, body)
+	r.mu.Lock()
+	n := r.counts[key]
+	r.counts[key] = n + 1
+	r.mu.Unlock()
+
+	b, err := json.MarshalIndent(cassette{
+		Request: reqData,
+		Response: recordedResponse{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Header:     http.Header{"Content-Type": resp.Header["Content-Type"]},
+			Body:       respBody,
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	file := r.path(key, n)
+	log.Printf("[DEBUG] Recording response of request %s to %s", req.Header.Get(requestIDHeader), file)
+	if err := ioutil.WriteFile(file, b, 0600); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// replay returns the recorded response matching the request
+func (r *cassettes) replay(req *http.Request, body []byte) (*http.Response, error) {
+	key, reqData := requestKey(req, body)
+
+	r.mu.Lock()
+	n := r.counts[key]
+	b, err := ioutil.ReadFile(r.path(key, n))
+	if os.IsNotExist(err) && n > 0 {
+		b, err = ioutil.ReadFile(r.path(key, n-1))
+	} else if err == nil {
+		r.counts[key] = n + 1
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s %s: %w", reqData.Method, reqData.URI, ErrorNoRecording)
+		}
+
+		return nil, err
+	}
+
+	var cas cassette
+	if err := json.Unmarshal(b, &cas); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DEBUG] Replaying response of request %s", req.Header.Get(requestIDHeader))
+	return &http.Response{
+		Status:     cas.Response.Status,
+		StatusCode: cas.Response.StatusCode,
+		Header:     cas.Response.Header,
+		Body:       ioutil.NopCloser(bytes.NewReader(cas.Response.Body)),
+		Request:    req,
+	}, nil
+}
+
+// generatesKeys reports whether the request generates a key pair, whose response contains the private key
+func generatesKeys(req *http.Request) bool {
+	return req.Method == "POST" && path.Base(req.URL.Path) == "keys"
+}
+
+func (r *cassettes) path(key string, n int) string {
+	return filepath.Join(r.dir, fmt.Sprintf("%s_%03d.json", key, n))
+}
+
+// requestKey returns the file name prefix matching the request and the request as recorded
+func requestKey(req *http.Request, body []byte) (string, recordedRequest) {
+	data := recordedRequest{
+		Method: req.Method,
+		URI:    req.URL.RequestURI(),
+		Body:   string(redactPassword(body)),
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n%s", data.Method, data.URI, data.Body)
+
+	name := strings.Trim(req.URL.Path, "/")
+	if name == "" {
+		name = "index"
+	}
+	name = strings.Replace(name, "/", "-", -1)
+
+	return fmt.Sprintf("%s_%s_%s", strings.ToLower(data.Method), name, hex.EncodeToString(h.Sum(nil))[:12]), data
+}
+
+// requestBody reads the body of the request and restores it to be sent
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	defer req.Body.Close()
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,110 @@
+package cherrypy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassettes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	job := MinionJob{
+		Target:   ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function: "test.ping",
+	}
+
+	tester, _ := setup(t)
+	tester.Setup(t, "minions_submit", "single")
+	tester.Setup(t, "jobs_get", "complete")
+	tester.Setup(t, "index", "unavailable")
+
+	c := newClient(t, tester, WithRecorder(dir))
+	c.Token = testToken
+	recorded, err := c.RunJob(context.Background(), job, 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Error(t, c.IsReady(context.Background()))
+	tester.Close()
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(files))
+
+	c = newClient(t, tester, WithReplay(dir))
+	c.Token = testToken
+	replayed, err := c.RunJob(context.Background(), job, 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, recorded, replayed)
+
+	err = c.IsReady(context.Background())
+	assert.Equal(t, 503, err.(*RequestError).StatusCode)
+
+	_, err = c.Stats(context.Background())
+	assert.True(t, errors.Is(err, ErrorNoRecording))
+}
+
+func TestRecordAndReplayBinaryBody(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassettes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	body := []byte{0x1f, 0x8b, 0xff, 0x00, 'o', 'k'}
+	req := httptest.NewRequest("GET", "http://master/archive", nil)
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/octet-stream"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}
+
+	_, err = newCassettes(dir).record(req, nil, resp)
+	assert.NoError(t, err)
+
+	replayed, err := newCassettes(dir).replay(req, nil)
+	assert.NoError(t, err)
+
+	b, err := ioutil.ReadAll(replayed.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, b)
+}
+
+func TestRecordSkipsKeyPairs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassettes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tester, _ := setup(t)
+	tester.Setup(t, "keys_generate", "success")
+
+	c := newClient(t, tester, WithRecorder(dir))
+	c.Token = testToken
+	keys, err := c.GenerateKeyPair(context.Background(), "minion4", 2048, false)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, keys.Private)
+	tester.Close()
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+	c = newClient(t, tester, WithReplay(dir))
+	c.Token = testToken
+	err = c.GenerateKeyPairArchive(context.Background(), "minion4", 2048, false, ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrorNoRecording))
+}
@@ -0,0 +1,51 @@
+package cherrypy
+
+import (
+	"context"
+)
+
+type masterConfig struct {
+	FileRoots   map[string][]string `json:"file_roots"`
+	PillarRoots map[string][]string `json:"pillar_roots"`
+}
+
+/*
+FileRoots retrieves file_roots of the master as paths per environment
+
+Values are read from master configuration with config.values wheel function.
+
+https://docs.saltstack.com/en/latest/ref/wheel/all/salt.wheel.config.html#salt.wheel.config.values
+*/
+func (c *Client) FileRoots(ctx context.Context) (map[string][]string, error) {
+	cfg, err := c.masterConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.FileRoots, nil
+}
+
+/*
+PillarRoots retrieves pillar_roots of the master as paths per environment
+
+Values are read from master configuration with config.values wheel function.
+
+https://docs.saltstack.com/en/latest/ref/wheel/all/salt.wheel.config.html#salt.wheel.config.values
+*/
+func (c *Client) PillarRoots(ctx context.Context) (map[string][]string, error) {
+	cfg, err := c.masterConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.PillarRoots, nil
+}
+
+func (c *Client) masterConfig(ctx context.Context) (*masterConfig, error) {
+	var cfg masterConfig
+	if err := c.runWheel(ctx, "config.values", nil, &cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,32 @@
+package cherrypy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileRoots(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "wheel_config_values")
+
+	res, err := c.FileRoots(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/srv/salt", "/srv/spm/salt"}, res["base"])
+	assert.Equal(t, []string{"/srv/salt/prod"}, res["prod"])
+}
+
+func TestPillarRoots(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "wheel_config_values")
+
+	res, err := c.PillarRoots(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, []string{"/srv/pillar", "/srv/spm/pillar"}, res["base"])
+}
@@ -0,0 +1,154 @@
+package cherrypy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// Diagnostics describes the connection to rest_cherrypy, see Client.Diagnostics
+type Diagnostics struct {
+	// RemoteAddress is the resolved address of the server the request was sent to
+	RemoteAddress string
+
+	// Status of the response to the request
+	Status string
+
+	// Latency is the round-trip time of the request including connection setup
+	Latency time.Duration
+
+	// TLSVersion is the negotiated version (e.g.: TLS 1.3); empty for plain HTTP
+	TLSVersion string
+
+	// PeerSubject and PeerNotAfter describe the leaf certificate of the server
+	PeerSubject  string
+	PeerNotAfter time.Time
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+/*
+Diagnostics requests the index endpoint without authentication and reports details of the connection
+
+Intended for troubleshooting connectivity; credentials are not required and any response status is reported as is.
+The request is sent on a new connection, never reused, so that the TLS handshake is observed. If the request fails
+after the server presented its certificate, e.g. because the certificate failed verification, the error is returned
+along with diagnostics describing the certificate.
+
+https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#salt.netapi.rest_cherrypy.app.LowDataAdapter.GET
+*/
+func (c *Client) Diagnostics(ctx context.Context) (*Diagnostics, error) {
+	var diag Diagnostics
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			diag.RemoteAddress = info.Conn.RemoteAddr().String()
+		},
+	}
+
+	req, err := c.newRequest(httptrace.WithClientTrace(ctx, trace), "GET", "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Del("X-Auth-Token")
+
+	if c.requestMutator != nil {
+		if err := c.requestMutator(req); err != nil {
+			return nil, err
+		}
+	}
+
+	tr := c.client.Transport.(*http.Transport).Clone()
+	tr.DisableKeepAlives = true
+	defer tr.CloseIdleConnections()
+
+	cfg := tr.TLSClientConfig
+	verify := !cfg.InsecureSkipVerify && !insecureSkipVerify(ctx)
+	serverName := cfg.ServerName
+	if serverName == "" {
+		serverName = req.URL.Hostname()
+	}
+
+	// Certificates are verified here instead of the handshake, so that they are described even if verification fails
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyPeerCertificate = func(raw [][]byte, _ [][]*x509.Certificate) error {
+		certs := make([]*x509.Certificate, len(raw))
+		for i, b := range raw {
+			cert, err := x509.ParseCertificate(b)
+			if err != nil {
+				return err
+			}
+
+			certs[i] = cert
+		}
+
+		if len(certs) == 0 {
+			return nil
+		}
+
+		diag.PeerSubject = certs[0].Subject.String()
+		diag.PeerNotAfter = certs[0].NotAfter
+
+		if !verify {
+			return nil
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         cfg.RootCAs,
+			DNSName:       serverName,
+			Intermediates: intermediates,
+		})
+
+		return err
+	}
+
+	client := &http.Client{
+		Transport:     tr,
+		CheckRedirect: c.checkRedirect,
+	}
+
+	log.Println("[DEBUG] Sending diagnostics request")
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		if diag.PeerSubject != "" {
+			return &diag, err
+		}
+
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return nil, err
+	}
+
+	diag.Latency = time.Since(start)
+	diag.Status = resp.Status
+
+	if resp.TLS != nil {
+		diag.TLSVersion = tlsVersions[resp.TLS.Version]
+		if diag.TLSVersion == "" {
+			diag.TLSVersion = fmt.Sprintf("0x%04x", resp.TLS.Version)
+		}
+	}
+
+	return &diag, nil
+}
@@ -0,0 +1,88 @@
+package cherrypy
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnostics(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("X-Auth-Token"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, testUsername, testPassword, testEAuth, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token = testToken
+
+	res, err := c.Diagnostics(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimPrefix(srv.URL, "https://"), res.RemoteAddress)
+	assert.Equal(t, "401 Unauthorized", res.Status)
+	assert.NotEmpty(t, res.TLSVersion)
+	assert.Contains(t, res.PeerSubject, "Acme Co")
+	assert.Equal(t, srv.Certificate().NotAfter, res.PeerNotAfter)
+	assert.True(t, res.Latency > 0)
+}
+
+func TestDiagnosticsWithUnverifiedCertificate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Error("request sent despite unverified certificate")
+	}))
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, testUsername, testPassword, testEAuth, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Diagnostics(context.Background())
+
+	var unknown x509.UnknownAuthorityError
+	assert.True(t, errors.As(err, &unknown))
+	if assert.NotNil(t, res) {
+		assert.Contains(t, res.PeerSubject, "Acme Co")
+		assert.Equal(t, srv.Certificate().NotAfter, res.PeerNotAfter)
+	}
+}
+
+func TestDiagnosticsOpensNewConnection(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, testUsername, testPassword, testEAuth, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Diagnostics(context.Background())
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&conns))
+}
@@ -0,0 +1,334 @@
+package cherrypy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrorEventsUnavailable indicates rest_cherrypy refused to stream events with 401 or 403 error.
+	// Event stream might be disabled on the master or the user might lack permission to use it.
+	ErrorEventsUnavailable = errors.New("event stream is not available")
+)
+
+// Event is a message received from Salt's event bus
+type Event struct {
+	Tag  string                 `json:"tag"`
+	Data map[string]interface{} `json:"data"`
+}
+
+/*
+Events connects to the event bus of the master and streams the events on the returned channel
+
+Returns ErrorEventsUnavailable before starting to stream if the event stream is disabled or
+the user is not allowed to use it; callers may fall back to polling in that case.
+Channel is closed when stop is called, ctx is cancelled or the master terminates the stream.
+
+Deadline of ctx limits connecting to the stream only and is ignored once connected; once it passed,
+cancelling ctx no longer closes the stream and stop must be called instead. Calling stop more than once is safe.
+
+https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#events
+*/
+func (c *Client) Events(ctx context.Context) (<-chan Event, func(), error) {
+	return c.events(ctx, nil)
+}
+
+/*
+EventsFiltered streams the events with tags matching tagPattern on the returned channel, like Events
+
+Patterns are matched against the whole tag like Salt does, where * matches any sequence of characters
+including slashes and ? matches a single character; e.g. salt/job/* matches the events of all jobs.
+rest_cherrypy streams all events regardless, so the filtering is applied by the client before the channel.
+*/
+func (c *Client) EventsFiltered(ctx context.Context, tagPattern string) (<-chan Event, func(), error) {
+	re, err := tagRegexp(tagPattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.events(ctx, re.MatchString)
+}
+
+// events streams events with tags accepted by match, all events if match is nil
+func (c *Client) events(ctx context.Context, match func(string) bool) (<-chan Event, func(), error) {
+	stream, err := c.openEvents(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer stream.Close()
+
+		err := readEvents(stream, func(e Event) bool {
+			if match != nil && !match(e.Tag) {
+				return true
+			}
+
+			select {
+			case events <- e:
+				return true
+			case <-stream.ctx.Done():
+				return false
+			}
+		})
+
+		if err != nil && stream.ctx.Err() == nil {
+			log.Printf("[DEBUG] Event stream terminated: %s", err)
+		}
+	}()
+
+	return events, stream.cancel, nil
+}
+
+// tagRegexp translates a glob pattern of event tags to a regular expression matching whole tags
+func tagRegexp(pattern string) (*regexp.Regexp, error) {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, `\*`, ".*", -1)
+	expr = strings.Replace(expr, `\?`, ".", -1)
+	return regexp.Compile("^" + expr + "$")
+}
+
+/*
+EventsRaw copies the event stream of the master to w as received, without parsing it
+
+Blocks until ctx is cancelled, returning its error, or the master terminates the stream, returning nil.
+Deadline of ctx limits connecting only, like for Events; once it passed, copying stops when w returns an error.
+Returns ErrorEventsUnavailable like Events if the stream cannot be opened.
+*/
+func (c *Client) EventsRaw(ctx context.Context, w io.Writer) error {
+	stream, err := c.openEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer stream.Close()
+
+	if _, err := io.Copy(w, stream); err != nil {
+		if stream.ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+/*
+openEvents requests the event stream; the stream must be closed by the caller
+
+The deadline of ctx limits connecting only, the context of the stream is cancelled along with ctx
+but ignores its deadline once connected. Once the deadline passed, ctx can no longer cancel the stream.
+*/
+func (c *Client) openEvents(ctx context.Context) (*eventStream, error) {
+	sctx, cancel := context.WithCancel(detachedContext{ctx})
+	connected := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-sctx.Done():
+			return
+		}
+
+		select {
+		case <-connected:
+			if ctx.Err() == context.DeadlineExceeded {
+				return
+			}
+		default:
+		}
+
+		cancel()
+	}()
+
+	req, err := c.newRequest(sctx, "GET", "events", nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+
+	log.Println("[DEBUG] Sending events request")
+	resp, err := c.send(req)
+	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if rerr, ok := err.(*RequestError); ok {
+			if rerr.StatusCode == 401 || rerr.StatusCode == 403 {
+				return nil, fmt.Errorf("%s: %w", rerr.Status, ErrorEventsUnavailable)
+			}
+		}
+
+		return nil, err
+	}
+
+	close(connected)
+	return &eventStream{ReadCloser: resp.Body, ctx: sctx, cancel: cancel}, nil
+}
+
+// eventStream is the body of the event stream; cancel terminates the stream and Close releases it
+type eventStream struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (s *eventStream) Close() error {
+	s.cancel()
+	return s.ReadCloser.Close()
+}
+
+// eventBus shares a single event stream between subscribers
+type eventBus struct {
+	cancel context.CancelFunc
+	subs   map[*subscription]struct{}
+}
+
+type subscription struct {
+	prefix string
+	events chan Event
+	done   chan struct{}
+}
+
+/*
+Subscribe streams events with tags starting with tagPrefix on the returned channel
+
+Subscribers of the client share a single connection to the event bus, opened by the first subscriber
+with the values of its ctx and closed when the last subscriber unsubscribes.
+Returns ErrorEventsUnavailable like Events if the connection cannot be opened.
+
+Events are delivered to subscribers in order; a subscriber which does not receive its events holds up the others.
+No events are delivered after unsubscribe is called. Channel is closed when the master terminates the stream.
+*/
+func (c *Client) Subscribe(ctx context.Context, tagPrefix string) (<-chan Event, func(), error) {
+	c.busMu.Lock()
+	defer c.busMu.Unlock()
+
+	if c.bus == nil {
+		events, stop, err := c.Events(detachedContext{ctx})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		c.bus = &eventBus{
+			cancel: stop,
+			subs:   make(map[*subscription]struct{}),
+		}
+
+		go c.dispatchEvents(c.bus, events)
+	}
+
+	bus := c.bus
+	sub := &subscription{
+		prefix: tagPrefix,
+		events: make(chan Event),
+		done:   make(chan struct{}),
+	}
+	bus.subs[sub] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			close(sub.done)
+
+			c.busMu.Lock()
+			defer c.busMu.Unlock()
+
+			delete(bus.subs, sub)
+			if len(bus.subs) == 0 {
+				bus.cancel()
+				if c.bus == bus {
+					c.bus = nil
+				}
+			}
+		})
+	}
+
+	return sub.events, unsubscribe, nil
+}
+
+// dispatchEvents passes events of the stream to matching subscribers of bus until the stream terminates
+func (c *Client) dispatchEvents(bus *eventBus, events <-chan Event) {
+	for e := range events {
+		c.busMu.Lock()
+		subs := make([]*subscription, 0, len(bus.subs))
+		for s := range bus.subs {
+			if strings.HasPrefix(e.Tag, s.prefix) {
+				subs = append(subs, s)
+			}
+		}
+		c.busMu.Unlock()
+
+		for _, s := range subs {
+			select {
+			case s.events <- e:
+			case <-s.done:
+			}
+		}
+	}
+
+	c.busMu.Lock()
+	defer c.busMu.Unlock()
+
+	bus.cancel()
+	if c.bus == bus {
+		c.bus = nil
+	}
+
+	for s := range bus.subs {
+		close(s.events)
+	}
+	bus.subs = nil
+}
+
+// readEvents parses server-sent events and passes them to fn until fn returns false or the stream ends
+func readEvents(r io.Reader, fn func(Event) bool) error {
+	br := bufio.NewReader(r)
+
+	var data []byte
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(line) == 0:
+			if len(data) == 0 {
+				continue
+			}
+
+			var e Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				return fmt.Errorf("cannot decode event: %w", err)
+			}
+
+			data = data[:0]
+			if !fn(e) {
+				return nil
+			}
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))...)
+		}
+	}
+}
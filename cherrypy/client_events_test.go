@@ -0,0 +1,299 @@
+package cherrypy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "events", "success")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, stop, err := c.Events(ctx)
+	assert.NoError(t, err)
+	defer stop()
+
+	var events []Event
+	for e := range ch {
+		events = append(events, e)
+	}
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "salt/job/20200208103243256542/new", events[0].Tag)
+	assert.Equal(t, "test.ping", events[0].Data["fun"])
+	assert.Equal(t, "salt/job/20200208103243256542/ret/minion1", events[1].Tag)
+	assert.Equal(t, true, events[1].Data["return"])
+}
+
+func TestEventsFiltered(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "events", "success")
+
+	ch, stop, err := c.EventsFiltered(context.Background(), "salt/job/*/ret/*")
+	assert.NoError(t, err)
+	defer stop()
+
+	var events []Event
+	for e := range ch {
+		events = append(events, e)
+	}
+
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "salt/job/20200208103243256542/ret/minion1", events[0].Tag)
+}
+
+func TestTagRegexp(t *testing.T) {
+	re, err := tagRegexp("salt/job/*/ret/minion?")
+	assert.NoError(t, err)
+
+	assert.True(t, re.MatchString("salt/job/20200208103243256542/ret/minion1"))
+	assert.False(t, re.MatchString("salt/job/20200208103243256542/ret/minion10"))
+	assert.False(t, re.MatchString("salt/job/20200208103243256542/new"))
+	assert.False(t, re.MatchString("prefix/salt/job/1/ret/minion1"))
+}
+
+func TestEventsIgnoresDeadlineOnceConnected(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("events", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		time.Sleep(100 * time.Millisecond)
+		io.Copy(w, s.Response.Body)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	ch, stop, err := c.Events(ctx)
+	assert.NoError(t, err)
+	defer stop()
+
+	var events []Event
+	for e := range ch {
+		events = append(events, e)
+	}
+
+	assert.Equal(t, 2, len(events))
+}
+
+func TestEventsStopAfterDeadline(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("events", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	ch, stop, err := c.Events(ctx)
+	assert.NoError(t, err)
+
+	<-ctx.Done()
+	stop()
+	stop()
+
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("stream was not stopped")
+	}
+}
+
+func TestEventsConnectDeadline(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("events", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	ch, stop, err := c.Events(ctx)
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Nil(t, ch)
+	assert.Nil(t, stop)
+}
+
+func TestEventsUnavailable(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "events", "unavailable")
+
+	ch, stop, err := c.Events(context.Background())
+
+	assert.True(t, errors.Is(err, ErrorEventsUnavailable))
+	assert.Nil(t, ch)
+	assert.Nil(t, stop)
+}
+
+func TestEventsRaw(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("events", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := ioutil.ReadAll(s.Response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester.Setup(t, "events", "success")
+
+	var buf bytes.Buffer
+	err = c.EventsRaw(context.Background(), &buf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), buf.String())
+}
+
+func TestEventsRawCancelled(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("events", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		cancel()
+		<-req.Context().Done()
+	})
+
+	err = c.EventsRaw(ctx, ioutil.Discard)
+
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestSubscribe(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("events", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connections := 0
+	release := make(chan struct{})
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		connections++
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		<-release
+		if _, err := s.Response.Body.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(w, s.Response.Body)
+	})
+
+	all, unsubscribeAll, err := c.Subscribe(context.Background(), "")
+	assert.NoError(t, err)
+	defer unsubscribeAll()
+
+	returns, unsubscribeReturns, err := c.Subscribe(context.Background(), "salt/job/20200208103243256542/ret/")
+	assert.NoError(t, err)
+	defer unsubscribeReturns()
+
+	close(release)
+
+	done := make(chan []Event)
+	go func() {
+		var events []Event
+		for e := range returns {
+			events = append(events, e)
+		}
+		done <- events
+	}()
+
+	var events []Event
+	for e := range all {
+		events = append(events, e)
+	}
+
+	assert.Equal(t, 1, connections)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, []Event{events[1]}, <-done)
+}
+
+func TestCloseTerminatesSubscriptions(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("events", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	})
+
+	ch, unsubscribe, err := c.Subscribe(context.Background(), "")
+	assert.NoError(t, err)
+	defer unsubscribe()
+
+	c.Close()
+
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func TestSubscribeUnavailable(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "events", "unavailable")
+
+	ch, unsubscribe, err := c.Subscribe(context.Background(), "salt/job/")
+
+	assert.True(t, errors.Is(err, ErrorEventsUnavailable))
+	assert.Nil(t, ch)
+	assert.Nil(t, unsubscribe)
+}
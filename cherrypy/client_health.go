@@ -0,0 +1,27 @@
+package cherrypy
+
+import (
+	"context"
+	"log"
+)
+
+/*
+IsReady checks whether rest_cherrypy is reachable and responding
+
+Index endpoint is requested without authentication; therefore a token is not required.
+Suitable for readiness probes as it does not contact the minions.
+
+https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#salt.netapi.rest_cherrypy.app.LowDataAdapter.GET
+*/
+func (c *Client) IsReady(ctx context.Context) error {
+	req, err := c.newRequest(ctx, "GET", "", nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Del("X-Auth-Token")
+
+	log.Println("[DEBUG] Sending readiness request")
+	_, err = c.do(req, nil)
+	return err
+}
@@ -0,0 +1,39 @@
+package cherrypy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	apiTester "github.com/finarfin/go-apiclient-tester/tester"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsReady(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("index", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("X-Auth-Token"))
+		apiTester.WriteResponse(t, &s.Response, w)
+	})
+
+	err = c.IsReady(context.Background())
+
+	assert.NoError(t, err)
+}
+
+func TestIsReadyUnavailable(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "index", "unavailable")
+
+	err := c.IsReady(context.Background())
+
+	assert.Error(t, err)
+	assert.Equal(t, 503, err.(*RequestError).StatusCode)
+}
@@ -18,6 +18,16 @@ Hook fires an event on Salt's event bus
 All events are prefixed with salt/netapi/hook.
 Therefore if the id is set to "test"; Salt Reactor will receive "salt/netapi/hook/test" event.
 
+Retrying a hook after a network error may fire the event twice; if ctx carries a key set with
+WithIdempotencyKey, the key is sent in Idempotency-Key header and reaches the reactor in the headers
+of the event data. Reactions which are not idempotent should record the keys they processed,
+e.g. in sdb or a grain, and skip events with a recorded key:
+
+	{% set key = data['headers'].get('Idempotency-Key') %}
+	{% if key and not salt['sdb.get']('sdb://hooks/' ~ key) %}
+	...
+	{% endif %}
+
 https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#salt.netapi.rest_cherrypy.app.Webhook.POST
 */
 func (c *Client) Hook(ctx context.Context, id string, data interface{}) error {
@@ -26,7 +36,11 @@ func (c *Client) Hook(ctx context.Context, id string, data interface{}) error {
 		return err
 	}
 
-	log.Println("[DEBUG] Sending authentication request")
+	if key, ok := IdempotencyKey(ctx); ok {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+
+	log.Println("[DEBUG] Sending hook request")
 	var resp hookResponse
 	_, err = c.do(req, &resp)
 	if err != nil {
@@ -2,8 +2,11 @@ package cherrypy
 
 import (
 	"context"
+	"io"
+	"net/http"
 	"testing"
 
+	apiTester "github.com/finarfin/go-apiclient-tester/tester"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,3 +29,29 @@ func TestHookFailure(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestHookWithIdempotencyKey(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("hook", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		keys = append(keys, req.Header.Get("Idempotency-Key"))
+		if _, err := s.Response.Body.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		apiTester.WriteResponse(t, &s.Response, w)
+	})
+
+	ctx := WithIdempotencyKey(context.Background(), "deploy-42")
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, c.Hook(ctx, "test", nil))
+	}
+
+	assert.Equal(t, []string{"deploy-42", "deploy-42"}, keys)
+}
@@ -0,0 +1,201 @@
+package cherrypy
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pendingReturnTTL limits how long returns of jobs which are not tracked yet are kept
+const pendingReturnTTL = time.Minute
+
+// JobUpdate is the return of a minion for a job followed by JobTracker
+type JobUpdate struct {
+	ID      string
+	Minion  string
+	Return  interface{}
+	Success bool
+}
+
+/*
+JobTracker follows returns of many asynchronous jobs over a single event subscription
+
+Returns which arrive before the job is tracked, e.g. between SubmitJob() and Track(), are kept
+for a minute and delivered once the job is tracked.
+*/
+type JobTracker struct {
+	unsubscribe func()
+
+	mu      sync.Mutex
+	closed  bool
+	jobs    map[string]*trackedJob
+	pending map[string][]pendingReturn
+
+	// expiry lists pending returns in the order they were received, so that expired ones are pruned first
+	expiry []pendingReturn
+}
+
+type trackedJob struct {
+	updates chan JobUpdate
+	waiting map[string]bool
+	done    bool
+}
+
+type pendingReturn struct {
+	update   JobUpdate
+	received time.Time
+}
+
+/*
+NewJobTracker subscribes to job events of the master, see Subscribe()
+
+Returns ErrorEventsUnavailable if the event stream cannot be opened.
+Close should be called once the tracker is no longer needed.
+*/
+func (c *Client) NewJobTracker(ctx context.Context) (*JobTracker, error) {
+	events, unsubscribe, err := c.Subscribe(ctx, "salt/job/")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &JobTracker{
+		unsubscribe: unsubscribe,
+		jobs:        make(map[string]*trackedJob),
+		pending:     make(map[string][]pendingReturn),
+	}
+
+	go t.route(events)
+	return t, nil
+}
+
+/*
+Track streams the return of each minion of the job on the returned channel
+
+Channel is closed once all minions of the job returned, or when the event stream terminates or the tracker is closed;
+in which case minions which did not return yet are not reported.
+Tracking a job which is tracked already returns the channel of the job; minions are not added to it.
+*/
+func (t *JobTracker) Track(job AsyncMinionJobResult) <-chan JobUpdate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if j, ok := t.jobs[job.ID]; ok {
+		return j.updates
+	}
+
+	j := &trackedJob{
+		updates: make(chan JobUpdate, len(job.Minions)),
+		waiting: make(map[string]bool, len(job.Minions)),
+	}
+
+	for _, m := range job.Minions {
+		j.waiting[m] = true
+	}
+
+	t.jobs[job.ID] = j
+	for _, p := range t.pending[job.ID] {
+		t.deliver(j, p.update)
+	}
+	delete(t.pending, job.ID)
+
+	if t.closed || len(j.waiting) == 0 {
+		t.complete(job.ID, j)
+	}
+
+	return j.updates
+}
+
+// Close stops following jobs and closes the channels of tracked jobs
+func (t *JobTracker) Close() {
+	t.unsubscribe()
+	t.stop()
+}
+
+// route delivers return events to tracked jobs until the event stream terminates
+func (t *JobTracker) route(events <-chan Event) {
+	for e := range events {
+		// salt/job/<jid>/ret/<minion>
+		parts := strings.SplitN(e.Tag, "/", 5)
+		if len(parts) != 5 || parts[3] != "ret" {
+			continue
+		}
+
+		success, _ := e.Data["success"].(bool)
+		u := JobUpdate{
+			ID:      parts[2],
+			Minion:  parts[4],
+			Return:  e.Data["return"],
+			Success: success,
+		}
+
+		t.mu.Lock()
+		if j, ok := t.jobs[u.ID]; ok {
+			t.deliver(j, u)
+		} else if !t.closed {
+			t.keepPending(u, time.Now())
+		}
+		t.mu.Unlock()
+	}
+
+	t.stop()
+}
+
+func (t *JobTracker) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	for id, j := range t.jobs {
+		t.complete(id, j)
+	}
+}
+
+// deliver passes the update to the job if its minion is awaited; never blocks as updates has room for every minion
+func (t *JobTracker) deliver(j *trackedJob, u JobUpdate) {
+	if j.done || !j.waiting[u.Minion] {
+		return
+	}
+
+	delete(j.waiting, u.Minion)
+	j.updates <- u
+
+	if len(j.waiting) == 0 {
+		t.complete(u.ID, j)
+	}
+}
+
+func (t *JobTracker) complete(id string, j *trackedJob) {
+	if t.jobs[id] == j {
+		delete(t.jobs, id)
+	}
+
+	if !j.done {
+		j.done = true
+		close(j.updates)
+	}
+}
+
+// keepPending keeps the return of a job which is not tracked yet, dropping returns kept for longer than pendingReturnTTL
+func (t *JobTracker) keepPending(u JobUpdate, now time.Time) {
+	for len(t.expiry) > 0 && now.Sub(t.expiry[0].received) > pendingReturnTTL {
+		expired := t.expiry[0]
+		t.expiry = t.expiry[1:]
+
+		// returns of the job might have been delivered by Track already, or the job received newer returns since
+		returns := t.pending[expired.update.ID]
+		for len(returns) > 0 && !returns[0].received.After(expired.received) {
+			returns = returns[1:]
+		}
+
+		if len(returns) == 0 {
+			delete(t.pending, expired.update.ID)
+		} else {
+			t.pending[expired.update.ID] = returns
+		}
+	}
+
+	p := pendingReturn{update: u, received: now}
+	t.pending[u.ID] = append(t.pending[u.ID], p)
+	t.expiry = append(t.expiry, p)
+}
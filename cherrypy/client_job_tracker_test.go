@@ -0,0 +1,96 @@
+package cherrypy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobTracker(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "events", "success")
+
+	tracker, err := c.NewJobTracker(context.Background())
+	assert.NoError(t, err)
+	defer tracker.Close()
+
+	var updates []JobUpdate
+	for u := range tracker.Track(AsyncMinionJobResult{ID: "20200208103243256542", Minions: []string{"minion1"}}) {
+		updates = append(updates, u)
+	}
+
+	assert.Equal(t, []JobUpdate{{
+		ID:      "20200208103243256542",
+		Minion:  "minion1",
+		Return:  true,
+		Success: true,
+	}}, updates)
+}
+
+func TestJobTrackerWithoutMinions(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "events", "success")
+
+	tracker, err := c.NewJobTracker(context.Background())
+	assert.NoError(t, err)
+	defer tracker.Close()
+
+	_, ok := <-tracker.Track(AsyncMinionJobResult{})
+
+	assert.False(t, ok)
+}
+
+func TestJobTrackerTrackTwice(t *testing.T) {
+	events := make(chan Event)
+	tracker := &JobTracker{
+		unsubscribe: func() {},
+		jobs:        make(map[string]*trackedJob),
+		pending:     make(map[string][]pendingReturn),
+	}
+	go tracker.route(events)
+
+	job := AsyncMinionJobResult{ID: "20200208103243256542", Minions: []string{"minion1"}}
+	first := tracker.Track(job)
+	second := tracker.Track(job)
+	assert.Equal(t, first, second)
+
+	events <- Event{Tag: "salt/job/20200208103243256542/ret/minion1", Data: map[string]interface{}{"return": true, "success": true}}
+
+	u, ok := <-first
+	assert.True(t, ok)
+	assert.Equal(t, "minion1", u.Minion)
+
+	_, ok = <-first
+	assert.False(t, ok)
+
+	close(events)
+}
+
+func TestJobTrackerPrunesPendingReturns(t *testing.T) {
+	tracker := &JobTracker{
+		jobs:    make(map[string]*trackedJob),
+		pending: make(map[string][]pendingReturn),
+	}
+
+	start := time.Now()
+	tracker.keepPending(JobUpdate{ID: "1", Minion: "minion1"}, start)
+	tracker.keepPending(JobUpdate{ID: "2", Minion: "minion1"}, start.Add(30*time.Second))
+	tracker.keepPending(JobUpdate{ID: "1", Minion: "minion2"}, start.Add(45*time.Second))
+	tracker.keepPending(JobUpdate{ID: "3", Minion: "minion1"}, start.Add(pendingReturnTTL+time.Second))
+
+	assert.Equal(t, 1, len(tracker.pending["1"]))
+	assert.Equal(t, "minion2", tracker.pending["1"][0].update.Minion)
+	assert.Equal(t, 1, len(tracker.pending["2"]))
+	assert.Equal(t, 1, len(tracker.pending["3"]))
+	assert.Equal(t, 3, len(tracker.expiry))
+
+	tracker.keepPending(JobUpdate{ID: "4", Minion: "minion1"}, start.Add(2*pendingReturnTTL))
+
+	assert.NotContains(t, tracker.pending, "1")
+	assert.NotContains(t, tracker.pending, "2")
+	assert.Equal(t, 2, len(tracker.expiry))
+}
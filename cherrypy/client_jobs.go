@@ -2,8 +2,11 @@ package cherrypy
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -12,22 +15,136 @@ var (
 	ErrorJobNotFound = errors.New("job was not found")
 )
 
-// Job contains summary of a job returned by Jobs()
+/*
+Job contains summary of a job returned by Jobs()
+
+Target is encoded to JSON using tgt and tgt_type fields.
+*/
 type Job struct {
-	ID          string
-	Function    string
-	Target      Target
-	Arguments   []interface{}
-	KWArguments map[string]interface{}
-	StartTime   time.Time
-	User        string
+	ID          string                 `json:"jid"`
+	Function    string                 `json:"fun"`
+	Target      Target                 `json:"-"`
+	Arguments   []interface{}          `json:"arg"`
+	KWArguments map[string]interface{} `json:"kwarg"`
+	StartTime   time.Time              `json:"start_time"`
+	User        string                 `json:"user"`
+}
+
+// plainJob is Job without its JSON methods
+type plainJob Job
+
+// MarshalJSON encodes the job along with its target
+func (j Job) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		plainJob
+		targetJSON
+	}{plainJob(j), newTargetJSON(j.Target)})
+}
+
+// UnmarshalJSON decodes the job along with its target
+func (j *Job) UnmarshalJSON(b []byte) error {
+	d := struct {
+		*plainJob
+		targetJSON
+	}{plainJob: (*plainJob)(j)}
+
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	target, err := d.targetJSON.parse()
+	if err != nil {
+		return err
+	}
+
+	j.Target = target
+
+	return nil
 }
 
 // JobDetails contain job summary and returns per minion
 type JobDetails struct {
 	Job
-	Minions []string
-	Returns map[string]interface{}
+	Minions []string               `json:"minions"`
+	Returns map[string]interface{} `json:"returns"`
+
+	// ReturnCodes contains the retcode of each minion which returned, if stored by the job cache
+	ReturnCodes map[string]int `json:"retcodes,omitempty"`
+}
+
+type jobDetailsJSON struct {
+	plainJob
+	targetJSON
+	Minions     []string               `json:"minions"`
+	Returns     map[string]interface{} `json:"returns"`
+	ReturnCodes map[string]int         `json:"retcodes,omitempty"`
+}
+
+// MarshalJSON encodes the job details along with the target of the job
+func (j JobDetails) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jobDetailsJSON{
+		plainJob:    plainJob(j.Job),
+		targetJSON:  newTargetJSON(j.Target),
+		Minions:     j.Minions,
+		Returns:     j.Returns,
+		ReturnCodes: j.ReturnCodes,
+	})
+}
+
+// UnmarshalJSON decodes the job details along with the target of the job
+func (j *JobDetails) UnmarshalJSON(b []byte) error {
+	var d jobDetailsJSON
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	*j = JobDetails{
+		Job:         Job(d.plainJob),
+		Minions:     d.Minions,
+		Returns:     d.Returns,
+		ReturnCodes: d.ReturnCodes,
+	}
+	target, err := d.targetJSON.parse()
+	if err != nil {
+		return err
+	}
+
+	j.Target = target
+
+	return nil
+}
+
+/*
+IsRunner reports whether the job was executed by a runner or wheel module on the master
+
+Such jobs do not have per minion returns; use RunnerReturn() to retrieve their result.
+*/
+func (j *Job) IsRunner() bool {
+	return strings.HasPrefix(j.Function, "runner.") || strings.HasPrefix(j.Function, "wheel.")
+}
+
+/*
+RunnerReturn returns the result of a runner or wheel job
+
+Master stores a single return for these jobs under its own id; it is unwrapped here.
+Returns nil for jobs executed on minions.
+*/
+func (j *JobDetails) RunnerReturn() interface{} {
+	if !j.IsRunner() {
+		return nil
+	}
+
+	for _, v := range j.Returns {
+		if d, ok := v.(map[string]interface{}); ok {
+			if r, ok := d["return"]; ok {
+				return r
+			}
+		}
+
+		return v
+	}
+
+	return nil
 }
 
 type jobResult struct {
@@ -77,6 +194,10 @@ func (c *Client) Job(ctx context.Context, id string) (*JobDetails, error) {
 		return nil, err
 	}
 
+	if len(resp.Info) != 1 || len(resp.Returns) != 1 {
+		return nil, fmt.Errorf("expected 1 results but received %d", len(resp.Info))
+	}
+
 	j := resp.Info[0]
 	job := JobDetails{
 		Minions: j.Minions,
@@ -88,11 +209,101 @@ func (c *Client) Job(ctx context.Context, id string) (*JobDetails, error) {
 	job.StartTime = j.StartTime.Time
 	job.User = j.User
 	job.Arguments, job.KWArguments = parseArgs(j.Arguments)
-	job.Target = parseTarget(j)
+	job.Target, err = parseTarget(j.Target, j.TargetType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+
+	if len(j.Result) > 0 {
+		job.ReturnCodes = make(map[string]int, len(j.Result))
+		for m, r := range j.Result {
+			job.ReturnCodes[m] = r.ReturnCode
+		}
+	}
 
 	return &job, nil
 }
 
+/*
+JobReturns retrieves returns of a single job and passes them to fn one minion at a time
+
+Response is decoded while it is being received, therefore returns of large jobs are not kept in memory.
+Job summary is skipped; use Job() to retrieve it. If fn returns an error, it is returned as is
+and the remaining returns are not processed. fn is not called if the job was not found.
+
+https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#get--jobs-(jid)
+*/
+func (c *Client) JobReturns(ctx context.Context, id string, fn func(minion string, ret interface{}) error) error {
+	req, err := c.newRequest(ctx, "GET", "jobs/"+id, nil)
+	if err != nil {
+		return err
+	}
+
+	log.Println("[DEBUG] Sending job returns request")
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if t != "return" {
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+
+		for dec.More() {
+			if err := expectDelim(dec, '{'); err != nil {
+				return err
+			}
+
+			for dec.More() {
+				t, err := dec.Token()
+				if err != nil {
+					return err
+				}
+
+				var ret interface{}
+				if err := dec.Decode(&ret); err != nil {
+					return err
+				}
+
+				if err := fn(t.(string), ret); err != nil {
+					return err
+				}
+			}
+
+			if err := expectDelim(dec, '}'); err != nil {
+				return err
+			}
+		}
+
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 /*
 Jobs retrieves status of all jobs from Salt Master.
 
@@ -111,11 +322,18 @@ func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
 		return nil, err
 	}
 
+	if len(resp.Jobs) != 1 {
+		return nil, fmt.Errorf("expected 1 results but received %d", len(resp.Jobs))
+	}
+
 	jobs := make([]Job, len(resp.Jobs[0]))
 	i := 0
 	for k, v := range resp.Jobs[0] {
 		args, kwArgs := parseArgs(v.Arguments)
-		target := parseTarget(v)
+		target, err := parseTarget(v.Target, v.TargetType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
 
 		jobs[i] = Job{
 			ID:          k,
@@ -133,21 +351,6 @@ func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
 	return jobs, nil
 }
 
-func parseTarget(j jobInfo) Target {
-	targetType := targetTypes[j.TargetType]
-	switch targetType {
-	case List:
-		return &ListTarget{
-			Targets: stringSlice(j.Target.([]interface{})),
-		}
-	default:
-		return &ExpressionTarget{
-			Expression: j.Target.(string),
-			Type:       targetType,
-		}
-	}
-}
-
 func parseArgs(arguments []interface{}) ([]interface{}, map[string]interface{}) {
 	args := make([]interface{}, 0)
 	kwargs := make(map[string]interface{})
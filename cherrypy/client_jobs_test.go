@@ -2,6 +2,7 @@ package cherrypy
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -29,6 +30,24 @@ func TestGetJob(t *testing.T) {
 	assert.Equal(t, "Can", res.KWArguments["complex_arg"].(map[string]interface{})["FIRST_NAME"])
 	assert.Equal(t, "echo Hello", res.Arguments[0])
 	assert.Equal(t, 1, len(res.Arguments))
+	assert.False(t, res.IsRunner())
+	assert.Nil(t, res.RunnerReturn())
+}
+
+func TestGetRunnerJob(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "jobs_get", "runner")
+
+	res, err := c.Job(context.Background(), "20200206195510232163")
+
+	assert.NoError(t, err)
+	assert.True(t, res.IsRunner())
+	assert.Equal(t, "runner.manage.status", res.Function)
+
+	ret := res.RunnerReturn().(map[string]interface{})
+	assert.Equal(t, []interface{}{"minion1"}, ret["up"])
+	assert.Equal(t, []interface{}{"minion2"}, ret["down"])
 }
 
 func TestGetMissingJob(t *testing.T) {
@@ -41,6 +60,49 @@ func TestGetMissingJob(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestGetJobReturns(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "jobs_get", "success")
+
+	returns := make(map[string]interface{})
+	err := c.JobReturns(context.Background(), testSampleJobID, func(minion string, ret interface{}) error {
+		returns[minion] = ret
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"minion1": "Hello"}, returns)
+}
+
+func TestGetJobReturnsAborted(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "jobs_get", "success")
+
+	abort := errors.New("abort")
+	err := c.JobReturns(context.Background(), testSampleJobID, func(minion string, ret interface{}) error {
+		return abort
+	})
+
+	assert.Equal(t, abort, err)
+}
+
+func TestGetMissingJobReturns(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "jobs_get", "missing")
+
+	called := false
+	err := c.JobReturns(context.Background(), "SampleMissingJobId", func(minion string, ret interface{}) error {
+		called = true
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.False(t, called)
+}
+
 func TestGetJobs(t *testing.T) {
 	tester, c := setup(t)
 	defer tester.Close()
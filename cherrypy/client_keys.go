@@ -35,9 +35,9 @@ type KeyResult struct {
 
 // MinionKeyPair contains key-pair for a minion
 type MinionKeyPair struct {
-	ID      string
-	Public  string
-	Private string
+	ID      string `json:"id"`
+	Public  string `json:"public"`
+	Private string `json:"private"`
 }
 
 type keyListResponse struct {
@@ -120,24 +120,8 @@ If force argument is true; existing keys will be overwriten and new keys will be
 https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#salt.netapi.rest_cherrypy.app.Keys.POST
 */
 func (c *Client) GenerateKeyPair(ctx context.Context, id string, keySize int, force bool) (*MinionKeyPair, error) {
-	data := keyGenerateRequest{
-		ID:       id,
-		KeySize:  keySize,
-		Force:    force,
-		Username: c.eauth.Username,
-		Password: c.eauth.Password,
-		Backend:  c.eauth.Backend,
-	}
-
-	req, err := c.newRequest(ctx, "POST", "keys", data)
-	if err != nil {
-		return nil, err
-	}
-
-	log.Println("[DEBUG] Sending generate key request")
 	br := new(bytes.Buffer)
-	_, err = c.do(req, br)
-	if err != nil {
+	if err := c.GenerateKeyPairArchive(ctx, id, keySize, force, br); err != nil {
 		return nil, err
 	}
 
@@ -182,3 +166,32 @@ func (c *Client) GenerateKeyPair(ctx context.Context, id string, keySize int, fo
 
 	return &keys, nil
 }
+
+/*
+GenerateKeyPairArchive generates and auto-accepts minion keypair on the master
+and writes the tar archive received from the master to w as is.
+
+The archive contains minion.pem and minion.pub files; use GenerateKeyPair() to receive them as strings.
+Behavior of force argument is same as GenerateKeyPair().
+
+https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#salt.netapi.rest_cherrypy.app.Keys.POST
+*/
+func (c *Client) GenerateKeyPairArchive(ctx context.Context, id string, keySize int, force bool, w io.Writer) error {
+	data := keyGenerateRequest{
+		ID:       id,
+		KeySize:  keySize,
+		Force:    force,
+		Username: c.eauth.Username,
+		Password: c.eauth.Password,
+		Backend:  c.eauth.Backend,
+	}
+
+	req, err := c.newRequest(ctx, "POST", "keys", data)
+	if err != nil {
+		return err
+	}
+
+	log.Println("[DEBUG] Sending generate key request")
+	_, err = c.do(req, w)
+	return err
+}
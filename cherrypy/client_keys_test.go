@@ -1,7 +1,10 @@
 package cherrypy
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -59,6 +62,30 @@ func TestGenerateKeySuccess(t *testing.T) {
 	assert.NotEmpty(t, res.Private)
 }
 
+func TestGenerateKeyArchive(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "keys_generate", "success")
+
+	buf := new(bytes.Buffer)
+	err := c.GenerateKeyPairArchive(context.Background(), "minion4", 2048, false, buf)
+	assert.NoError(t, err)
+
+	var files []string
+	tr := tar.NewReader(buf)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+
+		files = append(files, header.Name)
+	}
+
+	assert.ElementsMatch(t, []string{"minion.pub", "minion.pem"}, files)
+}
+
 func TestGenerateKeyFailure(t *testing.T) {
 	tester, c := setup(t)
 	defer tester.Close()
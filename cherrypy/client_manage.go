@@ -0,0 +1,25 @@
+package cherrypy
+
+import (
+	"context"
+)
+
+// MinionStatus contains connection status of minions known by the master
+type MinionStatus struct {
+	Up   []string `json:"up"`
+	Down []string `json:"down"`
+}
+
+/*
+Status retrieves lists of connected and disconnected minions with a single call to manage.status runner
+
+https://docs.saltstack.com/en/latest/ref/runners/all/salt.runners.manage.html#salt.runners.manage.status
+*/
+func (c *Client) Status(ctx context.Context) (*MinionStatus, error) {
+	var status MinionStatus
+	if err := c.runRunner(ctx, "manage.status", nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
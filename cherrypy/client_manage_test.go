@@ -0,0 +1,20 @@
+package cherrypy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "runner_manage_status")
+
+	res, err := c.Status(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"minion1"}, res.Up)
+	assert.Equal(t, []string{"minion2"}, res.Down)
+}
@@ -6,39 +6,215 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 )
 
+// collectTimeout limits how long RunJob waits for the returns gathered so far after ctx expires
+const collectTimeout = 10 * time.Second
+
+// defaultPollInterval is used by functions polling the master when the interval passed is not positive
+const defaultPollInterval = time.Second
+
 var (
 	// ErrorMinionNotFound indicates that minion was not found on Salt Master
 	ErrorMinionNotFound = errors.New("minion not found")
+
+	// ErrorInvalidSaltEnv indicates SaltEnv of MinionJob is blank or conflicts with its saltenv keyword argument
+	ErrorInvalidSaltEnv = errors.New("invalid saltenv")
+
+	// ErrorInvalidRawArguments indicates raw arguments of MinionJob are not valid JSON or are set along with decoded ones
+	ErrorInvalidRawArguments = errors.New("invalid raw arguments")
 )
 
 // Minion information
 type Minion struct {
-	ID     string
-	Grains map[string]interface{}
+	ID     string                 `json:"id"`
+	Grains map[string]interface{} `json:"grains"`
+
+	// Cached indicates grains were read from the master cache and might be stale
+	Cached bool `json:"cached"`
 }
 
-// MinionJob contains job information to be sent to the minion
+/*
+MinionJob contains job information to be sent to the minion
+
+MinionJob is encoded to JSON in Salt's low data format using tgt, tgt_type, fun, arg and kwarg fields.
+*/
 type MinionJob struct {
 	Target      Target
 	Function    string
 	Arguments   []interface{}
 	KWArguments map[string]interface{}
+
+	// SaltEnv selects the fileserver environment (e.g.: base, prod), sent as saltenv keyword argument.
+	// Applies only to functions using the fileserver, such as state and cp modules.
+	SaltEnv string
+
+	// RawArguments and RawKWArguments are sent as arg and kwarg fields without decoding, instead of
+	// Arguments and KWArguments; e.g. to keep the precision of numbers. They are not changed by
+	// WithLegacyKwargs() or WithKwargs() and RawKWArguments can not be combined with SaltEnv.
+	RawArguments   json.RawMessage
+	RawKWArguments json.RawMessage
+
+	// Timeout overrides how long the master waits for minions to return, sent as timeout in seconds.
+	// Master's timeout applies if zero.
+	Timeout time.Duration
+}
+
+// MarshalJSON encodes the job in Salt's low data format
+func (j MinionJob) MarshalJSON() ([]byte, error) {
+	d, err := newSubmitMinionJob(j)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(d)
+}
+
+// UnmarshalJSON decodes the job from Salt's low data format
+func (j *MinionJob) UnmarshalJSON(b []byte) error {
+	var d submitMinionJob
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	timeout, err := parseSaltSeconds(d.Timeout)
+	if err != nil {
+		return fmt.Errorf("timeout: %w", err)
+	}
+
+	*j = MinionJob{
+		Function:    d.Function,
+		Arguments:   d.Arguments,
+		KWArguments: d.KWArguments,
+		Timeout:     timeout,
+	}
+
+	if env, ok := d.KWArguments["saltenv"].(string); ok {
+		j.SaltEnv = env
+		delete(j.KWArguments, "saltenv")
+		if len(j.KWArguments) == 0 {
+			j.KWArguments = nil
+		}
+	}
+
+	target, err := d.targetJSON.parse()
+	if err != nil {
+		return err
+	}
+
+	j.Target = target
+
+	return nil
 }
 
 // AsyncMinionJobResult contains results of an async run with local client.
 type AsyncMinionJobResult struct {
 	ID      string   `json:"jid"`
 	Minions []string `json:"minions"`
+
+	// Warnings reported by the master while publishing the job, e.g. when the publish was limited.
+	// The job might not have been published to all targeted minions if there are any.
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 type submitMinionJob struct {
-	Target      interface{}            `json:"tgt"`
-	TargetType  TargetType             `json:"tgt_type"`
-	Function    string                 `json:"fun"`
-	Arguments   []interface{}          `json:"args,omitempty"`
-	KWArguments map[string]interface{} `json:"kwargs,omitempty"`
+	targetJSON
+	Function       string                 `json:"fun"`
+	Arguments      []interface{}          `json:"arg,omitempty"`
+	KWArguments    map[string]interface{} `json:"kwarg,omitempty"`
+	RawArguments   json.RawMessage        `json:"-"`
+	RawKWArguments json.RawMessage        `json:"-"`
+	Timeout        json.Number            `json:"timeout,omitempty"`
+}
+
+// MarshalJSON encodes the job with raw arguments in place of decoded ones, if set
+func (d submitMinionJob) MarshalJSON() ([]byte, error) {
+	v := struct {
+		targetJSON
+		Function    string      `json:"fun"`
+		Arguments   interface{} `json:"arg,omitempty"`
+		KWArguments interface{} `json:"kwarg,omitempty"`
+		Timeout     json.Number `json:"timeout,omitempty"`
+	}{targetJSON: d.targetJSON, Function: d.Function, Timeout: d.Timeout}
+
+	switch {
+	case d.RawArguments != nil:
+		v.Arguments = d.RawArguments
+	case len(d.Arguments) > 0:
+		v.Arguments = d.Arguments
+	}
+
+	switch {
+	case d.RawKWArguments != nil:
+		v.KWArguments = d.RawKWArguments
+	case len(d.KWArguments) > 0:
+		v.KWArguments = d.KWArguments
+	}
+
+	return json.Marshal(v)
+}
+
+func newSubmitMinionJob(j MinionJob) (submitMinionJob, error) {
+	d := submitMinionJob{
+		targetJSON:     newTargetJSON(j.Target),
+		Function:       j.Function,
+		Arguments:      j.Arguments,
+		KWArguments:    j.KWArguments,
+		RawArguments:   j.RawArguments,
+		RawKWArguments: j.RawKWArguments,
+	}
+
+	if j.Timeout > 0 {
+		d.Timeout = saltSeconds(j.Timeout)
+	}
+
+	if err := validateRawArguments("arg", j.RawArguments, len(j.Arguments) > 0); err != nil {
+		return d, err
+	}
+
+	if err := validateRawArguments("kwarg", j.RawKWArguments, len(j.KWArguments) > 0 || j.SaltEnv != ""); err != nil {
+		return d, err
+	}
+
+	if j.SaltEnv == "" {
+		return d, nil
+	}
+
+	if strings.TrimSpace(j.SaltEnv) == "" {
+		return d, fmt.Errorf("%q: %w", j.SaltEnv, ErrorInvalidSaltEnv)
+	}
+
+	if env, ok := j.KWArguments["saltenv"]; ok && env != j.SaltEnv {
+		return d, fmt.Errorf("%q conflicts with keyword argument %q: %w", j.SaltEnv, env, ErrorInvalidSaltEnv)
+	}
+
+	d.KWArguments = make(map[string]interface{}, len(j.KWArguments)+1)
+	for k, v := range j.KWArguments {
+		d.KWArguments[k] = v
+	}
+	d.KWArguments["saltenv"] = j.SaltEnv
+
+	return d, nil
+}
+
+// validateRawArguments checks raw is valid JSON and is not set along with decoded arguments
+func validateRawArguments(field string, raw json.RawMessage, decoded bool) error {
+	if raw == nil {
+		return nil
+	}
+
+	if decoded {
+		return fmt.Errorf("%s: raw and decoded arguments are both set: %w", field, ErrorInvalidRawArguments)
+	}
+
+	if !json.Valid(raw) {
+		return fmt.Errorf("%s: %w", field, ErrorInvalidRawArguments)
+	}
+
+	return nil
 }
 
 type submitMinionJobResponse struct {
@@ -52,6 +228,8 @@ type minionDetailResponse struct {
 /*
 Minion retrieves grains of a single minion from Salt Master
 
+Grains are read from the master cache; use Grains() to read them from the minion.
+
 If the minion is offline; grains will be empty.
 If the requested minion is not known by the master; ErrorMinionNotFound error will be thrown.
 
@@ -74,6 +252,8 @@ func (c *Client) Minion(ctx context.Context, id string) (*Minion, error) {
 /*
 Minions retrieves grains of all minions on a Salt Master
 
+Grains are read from the master cache; use Grains() to read them from the minions.
+
 Grains will be empty for offline minions.
 
 https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#get--minions-(mid)
@@ -82,6 +262,278 @@ func (c *Client) Minions(ctx context.Context) ([]Minion, error) {
 	return c.getMinions(ctx, "")
 }
 
+/*
+Grains retrieves grains of targeted minions by executing grains.items on them
+
+Unlike Minion() and Minions(), grains are read from the minions instead of the master cache.
+Minions which did not respond are not included.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.grains.html#salt.modules.grains.items
+*/
+func (c *Client) Grains(ctx context.Context, target Target) ([]Minion, error) {
+	res, err := c.runLocal(ctx, target, "grains.items", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	minions := make([]Minion, 0, len(res))
+	for k, r := range res {
+		var g map[string]interface{}
+		if err := json.Unmarshal(r.Return, &g); err != nil {
+			return nil, fmt.Errorf("%s: unexpected return: %w", k, err)
+		}
+
+		minions = append(minions, Minion{ID: k, Grains: g})
+	}
+
+	return minions, nil
+}
+
+/*
+MatchTargets returns ids of minions matched by the target according to the master cache, sorted
+
+Nothing is executed on the minions; matching is evaluated by cache.grains runner from cached grains and pillar,
+which makes it suitable to preview which minions a command would reach.
+Minions without cached data are not matched, use ResolveTargets() to query connected minions instead.
+
+https://docs.saltstack.com/en/latest/ref/runners/all/salt.runners.cache.html#salt.runners.cache.grains
+*/
+func (c *Client) MatchTargets(ctx context.Context, target Target) ([]string, error) {
+	args := map[string]interface{}{
+		"tgt":      target.GetTarget(),
+		"tgt_type": target.GetType(),
+	}
+
+	var grains map[string]json.RawMessage
+	if err := c.runRunner(ctx, "cache.grains", args, &grains); err != nil {
+		return nil, err
+	}
+
+	minions := make([]string, 0, len(grains))
+	for k := range grains {
+		minions = append(minions, k)
+	}
+
+	sort.Strings(minions)
+	return minions, nil
+}
+
+/*
+GrainsForTargeting returns the grains of minions matched by the target from the master cache, keyed by minion id
+
+Only the requested grains are returned, all grains if none are requested; grains missing on a minion are omitted.
+Like MatchTargets(), nothing is executed on the minions which makes it suitable to build target groups from
+grains of the whole fleet, e.g. by filtering on os and roles.
+
+https://docs.saltstack.com/en/latest/ref/runners/all/salt.runners.cache.html#salt.runners.cache.grains
+*/
+func (c *Client) GrainsForTargeting(ctx context.Context, target Target, grainKeys []string) (map[string]map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"tgt":      target.GetTarget(),
+		"tgt_type": target.GetType(),
+	}
+
+	var grains map[string]map[string]interface{}
+	if err := c.runRunner(ctx, "cache.grains", args, &grains); err != nil {
+		return nil, err
+	}
+
+	if len(grainKeys) == 0 {
+		return grains, nil
+	}
+
+	res := make(map[string]map[string]interface{}, len(grains))
+	for m, g := range grains {
+		res[m] = make(map[string]interface{}, len(grainKeys))
+		for _, k := range grainKeys {
+			if v, ok := g[k]; ok {
+				res[m][k] = v
+			}
+		}
+	}
+
+	return res, nil
+}
+
+/*
+ResolveTargets returns ids of minions which respond to test.ping for the target, sorted
+
+Passing the result as ListTarget keeps the set of targeted minions stable across a sequence
+of commands, even if minions join or leave while it runs.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.test.html#salt.modules.test.ping
+*/
+func (c *Client) ResolveTargets(ctx context.Context, target Target) ([]string, error) {
+	res, err := c.runLocal(ctx, target, "test.ping", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	minions := make([]string, 0, len(res))
+	for k, r := range res {
+		var ok bool
+		if json.Unmarshal(r.Return, &ok) == nil && ok {
+			minions = append(minions, k)
+		}
+	}
+
+	sort.Strings(minions)
+	return minions, nil
+}
+
+/*
+WaitForMinion pings the minion every interval until it responds, e.g. after its key was accepted
+
+Returns the error of ctx if it expires before the minion responds.
+The minion is pinged every second if interval is not positive.
+*/
+func (c *Client) WaitForMinion(ctx context.Context, minionID string, interval time.Duration) error {
+	ticker := time.NewTicker(pollInterval(interval))
+	defer ticker.Stop()
+
+	target := ListTarget{Targets: []string{minionID}}
+	for {
+		minions, err := c.ResolveTargets(ctx, target)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%s: %w", minionID, ctx.Err())
+			}
+
+			return err
+		}
+
+		if len(minions) == 1 && minions[0] == minionID {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", minionID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// MinionJobResult contains returns of a job collected by RunJob
+type MinionJobResult struct {
+	ID      string
+	Minions []string
+	Returns map[string]interface{}
+
+	// ReturnCodes contains the retcode of each minion which returned, if stored by the job cache
+	ReturnCodes map[string]int
+
+	// Missing contains targeted minions which did not return
+	Missing []string
+
+	// Partial indicates ctx expired before all targeted minions returned
+	Partial bool
+}
+
+/*
+RunJob submits the job asynchronously and polls its returns every interval until all targeted minions return
+
+If ctx expires before that, the returns gathered so far are looked up once more and returned with Partial set,
+instead of failing the whole call as a synchronous command would.
+Returns an empty result if no minions matched the target.
+Returns are polled every second if interval is not positive.
+*/
+func (c *Client) RunJob(ctx context.Context, job MinionJob, interval time.Duration) (*MinionJobResult, error) {
+	res, err := c.SubmitJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil || res.ID == "" {
+		return &MinionJobResult{}, nil
+	}
+
+	return c.collectJob(ctx, res, interval)
+}
+
+// collectJob polls returns of the submitted job every interval until all targeted minions return or ctx expires
+func (c *Client) collectJob(ctx context.Context, res *AsyncMinionJobResult, interval time.Duration) (*MinionJobResult, error) {
+	ticker := time.NewTicker(pollInterval(interval))
+	defer ticker.Stop()
+
+poll:
+	for {
+		details, err := c.Job(ctx, res.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				break poll
+			}
+
+			return nil, err
+		}
+
+		result := newMinionJobResult(res, details)
+		if len(result.Missing) == 0 {
+			return result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			break poll
+		case <-ticker.C:
+		}
+	}
+
+	cctx, cancel := context.WithTimeout(detachedContext{ctx}, collectTimeout)
+	defer cancel()
+
+	details, err := c.Job(cctx, res.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newMinionJobResult(res, details)
+	result.Partial = len(result.Missing) > 0
+	return result, nil
+}
+
+// pollInterval returns interval, or defaultPollInterval if interval is not positive
+func pollInterval(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return defaultPollInterval
+	}
+
+	return interval
+}
+
+/*
+ExitCode returns the exit code salt CLI reports for the job with --retcode-passthrough
+
+The highest retcode of the minions is returned, 0 if all minions returned and succeeded; see LocalResult.ExitCode().
+Minions which did not return fail the job like salt CLI does, therefore 1 is returned if some minions are missing
+and none of the returned minions reported a higher retcode.
+*/
+func (r *MinionJobResult) ExitCode() int {
+	code := exitCode(r.ReturnCodes)
+	if code == 0 && len(r.Missing) > 0 {
+		return 1
+	}
+
+	return code
+}
+
+func newMinionJobResult(job *AsyncMinionJobResult, details *JobDetails) *MinionJobResult {
+	result := &MinionJobResult{
+		ID:          job.ID,
+		Minions:     job.Minions,
+		Returns:     details.Returns,
+		ReturnCodes: details.ReturnCodes,
+	}
+
+	for _, m := range job.Minions {
+		if _, ok := details.Returns[m]; !ok {
+			result.Missing = append(result.Missing, m)
+		}
+	}
+
+	return result
+}
+
 /*
 SubmitJobs submits multiple jobs to be executed on minions asynchronously
 
@@ -90,13 +542,12 @@ https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.ht
 func (c *Client) SubmitJobs(ctx context.Context, jobs []MinionJob) ([]AsyncMinionJobResult, error) {
 	data := make([]submitMinionJob, len(jobs))
 	for i, v := range jobs {
-		data[i] = submitMinionJob{
-			Target:      v.Target.GetTarget(),
-			TargetType:  v.Target.GetType(),
-			Function:    v.Function,
-			Arguments:   v.Arguments,
-			KWArguments: v.KWArguments,
+		d, err := c.prepareJob(ctx, v)
+		if err != nil {
+			return nil, err
 		}
+
+		data[i] = d
 	}
 
 	req, err := c.newRequest(ctx, "POST", "minions", data)
@@ -114,6 +565,36 @@ func (c *Client) SubmitJobs(ctx context.Context, jobs []MinionJob) ([]AsyncMinio
 	return resp.Return, nil
 }
 
+// prepareJob validates the job and adds the keyword arguments of ctx according to the options of the client
+func (c *Client) prepareJob(ctx context.Context, job MinionJob) (submitMinionJob, error) {
+	d, err := newSubmitMinionJob(job)
+	if err != nil {
+		return d, err
+	}
+
+	if c.checkFunctions {
+		if d.Function, err = normalizeFunction(d.Function); err != nil {
+			return d, err
+		}
+	}
+
+	if d.RawKWArguments == nil {
+		d.KWArguments = mergeKwargs(ctx, d.KWArguments)
+	}
+
+	if c.legacyKwargs && d.RawArguments == nil && len(d.KWArguments) > 0 {
+		args, err := legacyArgs(d.Arguments, d.KWArguments)
+		if err != nil {
+			return d, err
+		}
+
+		d.Arguments = args
+		d.KWArguments = nil
+	}
+
+	return d, nil
+}
+
 /*
 SubmitJob submits a single job to be executed on minions asynchronously
 
@@ -154,7 +635,7 @@ func (c *Client) getMinions(ctx context.Context, id string) ([]Minion, error) {
 
 	i := 0
 	for k, m := range d {
-		minions[i] = Minion{ID: k}
+		minions[i] = Minion{ID: k, Cached: true}
 
 		// Grains are not returned for offline minions
 		var g map[string]interface{}
@@ -2,8 +2,10 @@ package cherrypy
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -18,6 +20,7 @@ func TestGetSingleOnlineMinion(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
 	assert.NotEmpty(t, res.Grains)
+	assert.True(t, res.Cached)
 }
 
 func TestGetSingleOfflineMinion(t *testing.T) {
@@ -46,6 +49,89 @@ func TestGetSingleMissingMinion(t *testing.T) {
 	assert.Nil(t, res)
 }
 
+func TestGetLiveGrains(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_grains_items")
+
+	res, err := c.Grains(context.Background(), ExpressionTarget{Expression: "minion1", Type: Glob})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "minion1", res[0].ID)
+	assert.Equal(t, "Ubuntu", res[0].Grains["os"])
+	assert.False(t, res[0].Cached)
+}
+
+func TestResolveTargets(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_test_ping_compound")
+
+	res, err := c.ResolveTargets(context.Background(), ExpressionTarget{Expression: "G@os:Ubuntu and minion*", Type: Compound})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"minion1", "minion3"}, res)
+}
+
+func TestMatchTargets(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "runner_cache_grains_compound")
+
+	res, err := c.MatchTargets(context.Background(), ExpressionTarget{Expression: "G@os:Ubuntu and minion*", Type: Compound})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"minion1", "minion3"}, res)
+}
+
+func TestGrainsForTargeting(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "runner_cache_grains_compound")
+
+	res, err := c.GrainsForTargeting(context.Background(), ExpressionTarget{Expression: "G@os:Ubuntu and minion*", Type: Compound}, []string{"os", "roles"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]interface{}{
+		"minion1": {"os": "Ubuntu"},
+		"minion3": {"os": "Ubuntu"},
+	}, res)
+}
+
+func TestWaitForMinion(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_test_ping_list_responsive")
+
+	err := c.WaitForMinion(context.Background(), "minion4", time.Millisecond)
+
+	assert.NoError(t, err)
+}
+
+func TestWaitForMinionWithoutInterval(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_test_ping_list_responsive")
+
+	err := c.WaitForMinion(context.Background(), "minion4", 0)
+
+	assert.NoError(t, err)
+}
+
+func TestWaitForUnresponsiveMinion(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_test_ping_list_unresponsive")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := c.WaitForMinion(ctx, "minion4", 10*time.Millisecond)
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
 func TestSubmitSingleJob(t *testing.T) {
 	tester, c := setup(t)
 	defer tester.Close()
@@ -61,6 +147,236 @@ func TestSubmitSingleJob(t *testing.T) {
 	assert.NotEmpty(t, res.ID)
 }
 
+func TestMinionJobJSON(t *testing.T) {
+	job := MinionJob{
+		Target:      &ExpressionTarget{Expression: "ip6_interfaces|eth0|fe80::1", Type: Grain, Delimiter: "|"},
+		Function:    "test.arg",
+		Arguments:   []interface{}{"a"},
+		KWArguments: map[string]interface{}{"b": "c"},
+		SaltEnv:     "prod",
+	}
+
+	b, err := json.Marshal(job)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"tgt":"ip6_interfaces|eth0|fe80::1","tgt_type":"grain","delimiter":"|","fun":"test.arg","arg":["a"],"kwarg":{"b":"c","saltenv":"prod"}}`, string(b))
+
+	var res MinionJob
+	assert.NoError(t, json.Unmarshal(b, &res))
+	assert.Equal(t, job, res)
+}
+
+func TestMinionJobJSONWithTimeout(t *testing.T) {
+	job := MinionJob{
+		Target:   &ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function: "test.sleep",
+		Timeout:  1500 * time.Millisecond,
+	}
+
+	b, err := json.Marshal(job)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"tgt":"minion1","tgt_type":"glob","fun":"test.sleep","timeout":1.5}`, string(b))
+
+	var res MinionJob
+	assert.NoError(t, json.Unmarshal(b, &res))
+	assert.Equal(t, job, res)
+}
+
+func TestMinionJobJSONWithInvalidListTarget(t *testing.T) {
+	var res MinionJob
+	err := json.Unmarshal([]byte(`{"tgt":[1],"tgt_type":"list","fun":"test.ping"}`), &res)
+
+	assert.Error(t, err)
+}
+
+func TestMinionJobJSONWithRawArguments(t *testing.T) {
+	job := MinionJob{
+		Target:         ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function:       "test.arg",
+		RawArguments:   json.RawMessage(`[12345678901234567890]`),
+		RawKWArguments: json.RawMessage(`{"ratio": 0.10000000000000000555}`),
+	}
+
+	b, err := json.Marshal(job)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"tgt":"minion1","tgt_type":"glob","fun":"test.arg","arg":[12345678901234567890],"kwarg":{"ratio":0.10000000000000000555}}`, string(b))
+}
+
+func TestSubmitSingleJobWithRawArguments(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "raw_arguments")
+
+	res, err := c.SubmitJob(context.Background(), MinionJob{
+		Target:         ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function:       "test.arg",
+		RawArguments:   json.RawMessage(`[12345678901234567890]`),
+		RawKWArguments: json.RawMessage(`{"ratio": 0.10000000000000000555}`),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "20200212171146520017", res.ID)
+}
+
+func TestSubmitSingleJobWithInvalidRawArguments(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+
+	_, err := c.SubmitJob(context.Background(), MinionJob{
+		Target:       ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function:     "test.arg",
+		Arguments:    []interface{}{"a"},
+		RawArguments: json.RawMessage(`["b"]`),
+	})
+
+	assert.True(t, errors.Is(err, ErrorInvalidRawArguments))
+}
+
+func TestSubmitSingleJobWithLegacyKwargs(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "legacy_kwargs")
+
+	c := newClient(t, tester, WithLegacyKwargs())
+	c.Token = testToken
+
+	res, err := c.SubmitJob(context.Background(), MinionJob{
+		Target:      ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function:    "cmd.run",
+		Arguments:   []interface{}{"echo Hello"},
+		KWArguments: map[string]interface{}{"cwd": "/tmp", "env": map[string]string{"LANG": "C"}},
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, res.Minions, "minion1")
+	assert.NotEmpty(t, res.ID)
+}
+
+func TestSubmitSingleJobWithWarnings(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "warnings")
+
+	res, err := c.SubmitJob(context.Background(), MinionJob{
+		Target:   ExpressionTarget{Expression: "minion*", Type: Glob},
+		Function: "test.ping",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"minion1"}, res.Minions)
+	assert.Equal(t, []string{"Publish was limited to 1 minions by max_minions"}, res.Warnings)
+}
+
+func TestSubmitSingleJobWithSaltEnv(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "saltenv")
+
+	res, err := c.SubmitJob(context.Background(), MinionJob{
+		Target:    ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function:  "state.apply",
+		Arguments: []interface{}{"webserver"},
+		SaltEnv:   "prod",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "20200211101532409127", res.ID)
+}
+
+func TestSubmitSingleJobWithInvalidSaltEnv(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+
+	_, err := c.SubmitJob(context.Background(), MinionJob{
+		Target:      ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function:    "state.apply",
+		KWArguments: map[string]interface{}{"saltenv": "base"},
+		SaltEnv:     "prod",
+	})
+
+	assert.True(t, errors.Is(err, ErrorInvalidSaltEnv))
+}
+
+func TestRunJob(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "single")
+	tester.Setup(t, "jobs_get", "complete")
+
+	res, err := c.RunJob(context.Background(), MinionJob{
+		Target:   ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function: "test.ping",
+	}, 10*time.Millisecond)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "20200202220915030498", res.ID)
+	assert.Equal(t, true, res.Returns["minion1"])
+	assert.Empty(t, res.Missing)
+	assert.False(t, res.Partial)
+	assert.Equal(t, map[string]int{"minion1": 0}, res.ReturnCodes)
+	assert.Equal(t, 0, res.ExitCode())
+}
+
+func TestRunJobWithoutInterval(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "single")
+	tester.Setup(t, "jobs_get", "complete")
+
+	res, err := c.RunJob(context.Background(), MinionJob{
+		Target:   ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function: "test.ping",
+	}, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, true, res.Returns["minion1"])
+}
+
+func TestPollInterval(t *testing.T) {
+	assert.Equal(t, defaultPollInterval, pollInterval(0))
+	assert.Equal(t, defaultPollInterval, pollInterval(-time.Second))
+	assert.Equal(t, 10*time.Millisecond, pollInterval(10*time.Millisecond))
+}
+
+func TestRunJobPartial(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "minions_submit", "glob")
+	tester.Setup(t, "jobs_get", "success")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	res, err := c.RunJob(ctx, MinionJob{
+		Target:    ExpressionTarget{Expression: "*", Type: Glob},
+		Function:  "cmd.run",
+		Arguments: []interface{}{"echo Hello"},
+	}, 10*time.Millisecond)
+
+	assert.NoError(t, err)
+	assert.Equal(t, testSampleJobID, res.ID)
+	assert.Equal(t, "Hello", res.Returns["minion1"])
+	assert.Equal(t, []string{"minion2"}, res.Missing)
+	assert.True(t, res.Partial)
+	assert.Equal(t, 1, res.ExitCode())
+}
+
+func TestMinionJobResultExitCode(t *testing.T) {
+	cases := []struct {
+		result MinionJobResult
+		code   int
+	}{
+		{MinionJobResult{ReturnCodes: map[string]int{"minion1": 0}}, 0},
+		{MinionJobResult{ReturnCodes: map[string]int{"minion1": 0}, Missing: []string{"minion2"}}, 1},
+		{MinionJobResult{ReturnCodes: map[string]int{"minion1": 2}, Missing: []string{"minion2"}}, 2},
+		{MinionJobResult{Missing: []string{"minion1"}}, 1},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.code, tc.result.ExitCode(), tc.result)
+	}
+}
+
 func TestSubmitSingleJobToOfflineMinion(t *testing.T) {
 	tester, c := setup(t)
 	defer tester.Close()
@@ -0,0 +1,208 @@
+package cherrypy
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	// ErrorNoCertificates indicates a CA bundle does not contain any valid PEM encoded certificates
+	ErrorNoCertificates = errors.New("no valid certificates found")
+)
+
+// ClientOption changes the default behavior of Client, see NewClient
+type ClientOption func(*Client) error
+
+/*
+WithFormLogin sends login requests form encoded instead of JSON encoded
+
+Some rest_cherrypy deployments only accept application/x-www-form-urlencoded login requests.
+*/
+func WithFormLogin() ClientOption {
+	return func(c *Client) error {
+		c.formLogin = true
+		return nil
+	}
+}
+
+/*
+WithLegacyKwargs sends keyword arguments as "key=value" strings appended to positional arguments
+
+Older masters and some modules ignore keyword arguments sent separately.
+Values other than strings are JSON encoded, which Salt parses as YAML.
+Applies to MinionJob and helpers of the client; arguments of Command are sent as is.
+*/
+func WithLegacyKwargs() ClientOption {
+	return func(c *Client) error {
+		c.legacyKwargs = true
+		return nil
+	}
+}
+
+/*
+WithAuthObserver calls fn for each step of authentication lifecycle, see AuthEventType
+
+Intended for metrics such as login failure rate; fn is called synchronously and should return quickly.
+*/
+func WithAuthObserver(fn func(AuthEvent)) ClientOption {
+	return func(c *Client) error {
+		c.authObserver = fn
+		return nil
+	}
+}
+
+/*
+WithLateReturns makes synchronous local commands look up the returns of targeted minions which did not return
+in time in the job cache, looking up again once delay has passed if minions are still missing
+
+On loaded masters returns may reach the job cache after the master stopped gathering them for the command;
+they are added to the result and listed in LocalResult.Late. Applies to RunLocal() and the helpers executing
+functions on minions; RunCommand and RunCommands are not affected. The lookup is skipped if no minion returned
+and commands are only delayed if a targeted minion is still missing after the first lookup.
+*/
+func WithLateReturns(delay time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.lateReturns = delay
+		return nil
+	}
+}
+
+/*
+WithFunctionValidation makes the client check function names before sending them, instead of minions
+reporting them as not available
+
+Names are trimmed and must consist of a module and a function separated by a single dot (e.g.: test.ping);
+otherwise requests fail with ErrorInvalidFunction. Whether the function exists is not checked,
+see ListFunctions() for that.
+*/
+func WithFunctionValidation() ClientOption {
+	return func(c *Client) error {
+		c.checkFunctions = true
+		return nil
+	}
+}
+
+/*
+WithConnectCheck makes NewClient check rest_cherrypy is reachable with IsReady() after applying the other options
+
+Catches a wrong address or TLS configuration at startup instead of on the first request.
+*/
+func WithConnectCheck() ClientOption {
+	return func(c *Client) error {
+		c.connectCheck = true
+		return nil
+	}
+}
+
+/*
+WithRootCAFile verifies the certificate of rest_cherrypy against the PEM encoded CA bundle at path
+instead of the system roots
+
+Returns ErrorNoCertificates if the file does not contain any valid certificates.
+*/
+func WithRootCAFile(path string) ClientOption {
+	return func(c *Client) error {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot read CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("%s: %w", path, ErrorNoCertificates)
+		}
+
+		c.client.Transport.(*http.Transport).TLSClientConfig.RootCAs = pool
+		return nil
+	}
+}
+
+/*
+WithRequestMutator calls fn with each request right before it is sent, including login and logout requests
+
+fn may change headers or the URL, e.g. to sign requests for a gateway in front of rest_cherrypy.
+The request is not sent if fn returns an error; the error is returned to the caller.
+*/
+func WithRequestMutator(fn func(*http.Request) error) ClientOption {
+	return func(c *Client) error {
+		c.requestMutator = fn
+		return nil
+	}
+}
+
+/*
+WithDryRun logs requests instead of sending them, for validating the commands issued by a program
+
+Each request is logged with its method, URL and body; passwords in the body are redacted.
+Every response is a single empty return: commands return no minions, asynchronous jobs are not published and
+helpers which require a result, such as runner and wheel based ones, return an error.
+*/
+func WithDryRun() ClientOption {
+	return func(c *Client) error {
+		c.dryRun = true
+		return nil
+	}
+}
+
+/*
+WithRecorder writes each request and its response to a file in dir, to be replayed with WithReplay e.g. in tests
+
+Passwords in request bodies are redacted, but responses are recorded as received and contain tokens
+and the results of the commands; dir should be protected accordingly. Event streams and key pairs
+generated by GenerateKeyPair() and GenerateKeyPairArchive() are not recorded.
+*/
+func WithRecorder(dir string) ClientOption {
+	return func(c *Client) error {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+
+		c.recorder = newCassettes(dir)
+		return nil
+	}
+}
+
+/*
+WithReplay serves responses recorded by WithRecorder in dir instead of sending requests
+
+Requests are matched by method, URI and body; repeated requests are answered with the responses
+recorded for them in order. Requests without a recorded response fail with ErrorNoRecording.
+*/
+func WithReplay(dir string) ClientOption {
+	return func(c *Client) error {
+		c.replay = newCassettes(dir)
+		return nil
+	}
+}
+
+/*
+WithRedirectPolicy calls fn before following a redirect, with the same semantics as http.Client.CheckRedirect
+
+X-Auth-Token header is kept on redirects within the origin of the first request and removed from redirects
+to other origins before fn is called; fn may set it again. Without a policy up to 10 redirects are followed.
+*/
+func WithRedirectPolicy(fn func(req *http.Request, via []*http.Request) error) ClientOption {
+	return func(c *Client) error {
+		c.redirectPolicy = fn
+		return nil
+	}
+}
+
+/*
+WithFailFast makes helpers executing functions on minions fail if any targeted minion reports a failure
+
+Helpers such as Grains(), ServiceRestart() and StateSingle() return an error wrapping ErrorMinionFailed
+and naming the failed minions, instead of results which have to be inspected per minion.
+Minions fail when they return a non-zero retcode; RunCommand and RunCommands are not affected.
+*/
+func WithFailFast() ClientOption {
+	return func(c *Client) error {
+		c.failFast = true
+		return nil
+	}
+}
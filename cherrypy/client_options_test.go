@@ -0,0 +1,287 @@
+package cherrypy
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	apiTester "github.com/finarfin/go-apiclient-tester/tester"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRootCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"return": "Welcome", "clients": ["local"]}`))
+	}))
+	defer srv.Close()
+
+	path := writeTempFile(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	defer os.Remove(path)
+
+	c, err := NewClient(srv.URL, testUsername, testPassword, testEAuth, false, WithRootCAFile(path))
+
+	assert.NoError(t, err)
+	assert.NoError(t, c.IsReady(context.Background()))
+}
+
+func TestWithRootCAFileMissing(t *testing.T) {
+	_, err := NewClient("https://localhost:8000", testUsername, testPassword, testEAuth, false, WithRootCAFile("testdata/missing.pem"))
+
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestWithRootCAFileInvalid(t *testing.T) {
+	path := writeTempFile(t, []byte("not a certificate"))
+	defer os.Remove(path)
+
+	_, err := NewClient("https://localhost:8000", testUsername, testPassword, testEAuth, false, WithRootCAFile(path))
+
+	assert.True(t, errors.Is(err, ErrorNoCertificates))
+}
+
+func writeTempFile(t *testing.T, b []byte) string {
+	f, err := ioutil.TempFile("", "cherrypy-*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+func TestWithRequestMutator(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("stats", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "signed", req.Header.Get("X-Gateway-Signature"))
+		apiTester.WriteResponse(t, &s.Response, w)
+	})
+
+	c := newClient(t, tester, WithRequestMutator(func(req *http.Request) error {
+		req.Header.Set("X-Gateway-Signature", "signed")
+		return nil
+	}))
+	c.Token = testToken
+
+	_, err = c.Stats(context.Background())
+
+	assert.NoError(t, err)
+}
+
+func TestWithRequestMutatorError(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "stats", "success")
+
+	errSign := errors.New("cannot sign request")
+	c := newClient(t, tester, WithRequestMutator(func(req *http.Request) error {
+		return errSign
+	}))
+	c.Token = testToken
+
+	_, err := c.Stats(context.Background())
+
+	assert.True(t, errors.Is(err, errSign))
+}
+
+func TestWithDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(ioutil.Discard)
+
+	c, err := NewClient("http://127.0.0.1:1", testUsername, testPassword, testEAuth, false, WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.RunCommand(context.Background(), Command{
+		Client:   LocalClient,
+		Target:   ExpressionTarget{Expression: "*", Type: Glob},
+		Function: "state.apply",
+	})
+
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+	assert.Contains(t, buf.String(), "POST http://127.0.0.1:1/run")
+	assert.Contains(t, buf.String(), `"fun":"state.apply"`)
+	assert.NotContains(t, buf.String(), testPassword)
+
+	_, err = c.Job(context.Background(), testSampleJobID)
+
+	assert.Error(t, err)
+}
+
+func TestRedirectKeepsTokenWithinOrigin(t *testing.T) {
+	var token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/stats" {
+			http.Redirect(w, req, "/canonical/stats", http.StatusFound)
+			return
+		}
+
+		token = req.Header.Get("X-Auth-Token")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, testUsername, testPassword, testEAuth, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token = testToken
+
+	_, err = c.Stats(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, testToken, token)
+}
+
+func TestRedirectRemovesTokenAcrossOrigins(t *testing.T) {
+	token := "unset"
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token = req.Header.Get("X-Auth-Token")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer other.Close()
+
+	srv := httptest.NewServer(http.RedirectHandler(other.URL+"/stats", http.StatusFound))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, testUsername, testPassword, testEAuth, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token = testToken
+
+	_, err = c.Stats(context.Background())
+
+	assert.NoError(t, err)
+	assert.Empty(t, token)
+}
+
+func TestWithRedirectPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.RedirectHandler("/canonical/stats", http.StatusFound))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, testUsername, testPassword, testEAuth, false, WithRedirectPolicy(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Stats(context.Background())
+
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusFound, err.(*RequestError).StatusCode)
+}
+
+func TestWithFailFast(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_service_restart")
+
+	c := newClient(t, tester, WithFailFast())
+	c.Token = testToken
+
+	res, err := c.ServiceRestart(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "nginx")
+
+	assert.True(t, errors.Is(err, ErrorMinionFailed))
+	assert.Contains(t, err.Error(), "1 of 2 minions failed (minion3)")
+	assert.Nil(t, res)
+}
+
+func TestWithInsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, testUsername, testPassword, testEAuth, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token = testToken
+
+	_, err = c.Stats(context.Background())
+	assert.Error(t, err)
+
+	_, err = c.Stats(WithInsecureSkipVerify(context.Background()))
+	assert.NoError(t, err)
+}
+
+func TestCloseInsecureConnections(t *testing.T) {
+	closed := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			close(closed)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, testUsername, testPassword, testEAuth, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token = testToken
+
+	_, err = c.Stats(WithInsecureSkipVerify(context.Background()))
+	assert.NoError(t, err)
+
+	c.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection was not closed")
+	}
+}
+
+func TestWithConnectCheck(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "index", "success")
+
+	c, err := NewClient(tester.URL, testUsername, testPassword, testEAuth, false, WithConnectCheck())
+
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+}
+
+func TestWithConnectCheckUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	address := srv.URL
+	srv.Close()
+
+	c, err := NewClient(address, testUsername, testPassword, testEAuth, false, WithConnectCheck())
+
+	assert.True(t, errors.Is(err, ErrorUnreachable))
+	assert.Nil(t, c)
+}
@@ -0,0 +1,27 @@
+package cherrypy
+
+import (
+	"context"
+)
+
+/*
+ShowPillar renders pillar data of a minion on the master with pillar.show_pillar runner
+
+The minion is not contacted; therefore pillar of offline or not yet provisioned minions can be inspected.
+Pillar is rendered from pillarEnv if it is not empty.
+
+https://docs.saltstack.com/en/latest/ref/runners/all/salt.runners.pillar.html#salt.runners.pillar.show_pillar
+*/
+func (c *Client) ShowPillar(ctx context.Context, minionID string, pillarEnv string) (map[string]interface{}, error) {
+	args := map[string]interface{}{"minion": minionID}
+	if pillarEnv != "" {
+		args["pillarenv"] = pillarEnv
+	}
+
+	var pillar map[string]interface{}
+	if err := c.runRunner(ctx, "pillar.show_pillar", args, &pillar); err != nil {
+		return nil, err
+	}
+
+	return pillar, nil
+}
@@ -0,0 +1,20 @@
+package cherrypy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShowPillar(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "runner_pillar_show_pillar")
+
+	res, err := c.ShowPillar(context.Background(), "minion2", "prod")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "web", res["role"])
+	assert.Equal(t, float64(4), res["nginx"].(map[string]interface{})["worker_processes"])
+}
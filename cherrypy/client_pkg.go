@@ -0,0 +1,117 @@
+package cherrypy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+PkgChange is a version change of a package; Old is empty for installed packages and New for removed ones
+
+Versions are as reported by the package manager of the minion, comma separated if several versions are installed.
+*/
+type PkgChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// PkgResult contains the changes of packages per minion, keyed by package name
+type PkgResult struct {
+	Changes map[string]map[string]PkgChange
+
+	// Errors contains minions failing the command; minions which did not respond are not included in either
+	Errors map[string]error
+}
+
+/*
+PkgInstall installs the package on targeted minions with pkg.install; version is optional
+
+Packages already installed at the requested version are not included in the changes.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.pkg.html
+*/
+func (c *Client) PkgInstall(ctx context.Context, target Target, name string, version string) (*PkgResult, error) {
+	var kwarg map[string]interface{}
+	if version != "" {
+		kwarg = map[string]interface{}{"version": version}
+	}
+
+	return c.pkgAction(ctx, target, "pkg.install", name, kwarg)
+}
+
+/*
+PkgRemove removes the package from targeted minions with pkg.remove
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.pkg.html
+*/
+func (c *Client) PkgRemove(ctx context.Context, target Target, name string) (*PkgResult, error) {
+	return c.pkgAction(ctx, target, "pkg.remove", name, nil)
+}
+
+// PkgVersions contains the installed version of a package per minion
+type PkgVersions struct {
+	// Versions is empty for minions on which the package is not installed
+	Versions map[string]string
+
+	// Errors contains minions failing the command; minions which did not respond are not included in either
+	Errors map[string]error
+}
+
+/*
+PkgVersion returns the installed version of the package on targeted minions with pkg.version
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.pkg.html
+*/
+func (c *Client) PkgVersion(ctx context.Context, target Target, name string) (*PkgVersions, error) {
+	res, err := c.runLocal(ctx, target, "pkg.version", []interface{}{name}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PkgVersions{
+		Versions: make(map[string]string),
+		Errors:   make(map[string]error),
+	}
+
+	for k, r := range res {
+		var version string
+		if r.ReturnCode != 0 || json.Unmarshal(r.Return, &version) != nil {
+			result.Errors[k] = fmt.Errorf("pkg.version: %w: %s", ErrorCommandFailed, r.Return)
+			continue
+		}
+
+		result.Versions[k] = version
+	}
+
+	return result, nil
+}
+
+// pkgAction runs a pkg function returning the changed packages and collects the changes per minion
+func (c *Client) pkgAction(ctx context.Context, target Target, fun string, name string, kwarg map[string]interface{}) (*PkgResult, error) {
+	res, err := c.runLocal(ctx, target, fun, []interface{}{name}, kwarg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PkgResult{
+		Changes: make(map[string]map[string]PkgChange),
+		Errors:  make(map[string]error),
+	}
+
+	for k, r := range res {
+		var changes map[string]PkgChange
+		if r.ReturnCode != 0 || json.Unmarshal(r.Return, &changes) != nil {
+			result.Errors[k] = fmt.Errorf("%s: %w: %s", fun, ErrorCommandFailed, r.Return)
+			continue
+		}
+
+		if changes == nil {
+			changes = make(map[string]PkgChange)
+		}
+
+		result.Changes[k] = changes
+	}
+
+	return result, nil
+}
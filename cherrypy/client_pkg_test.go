@@ -0,0 +1,58 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPkgInstall(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_pkg_install")
+
+	res, err := c.PkgInstall(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "nginx", "1.18.0-0ubuntu1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]PkgChange{
+		"minion1": {
+			"nginx":        {New: "1.18.0-0ubuntu1"},
+			"nginx-common": {New: "1.18.0-0ubuntu1"},
+		},
+		"minion2": {},
+	}, res.Changes)
+	assert.Equal(t, 1, len(res.Errors))
+	assert.True(t, errors.Is(res.Errors["minion3"], ErrorCommandFailed))
+}
+
+func TestPkgRemove(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_pkg_remove")
+
+	res, err := c.PkgRemove(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "nginx")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]PkgChange{
+		"minion1": {
+			"nginx": {Old: "1.18.0-0ubuntu1"},
+		},
+		"minion2": {},
+	}, res.Changes)
+	assert.Empty(t, res.Errors)
+}
+
+func TestPkgVersion(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_pkg_version")
+
+	res, err := c.PkgVersion(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "nginx")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"minion1": "1.18.0-0ubuntu1", "minion3": ""}, res.Versions)
+	assert.Equal(t, 1, len(res.Errors))
+	assert.True(t, errors.Is(res.Errors["minion2"], ErrorCommandFailed))
+}
@@ -0,0 +1,102 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrorRolloutHalted indicates RollingApply stopped before processing all minions
+	ErrorRolloutHalted = errors.New("rollout halted")
+)
+
+// RollingOptions controls the waves of RollingApply
+type RollingOptions struct {
+	// WaveSize is the number of minions processed concurrently in a wave; defaults to 1
+	WaveSize int
+
+	// MaxFailures is the number of failed minions tolerated before halting the rollout
+	MaxFailures int
+
+	// Delay is the time to wait between waves
+	Delay time.Duration
+
+	// HealthCheck is called with the minions of a completed wave before starting the next one.
+	// Rollout halts if it returns an error.
+	HealthCheck func(minions []string) error
+}
+
+/*
+RollingApply calls apply for minions responding to the target in waves, halting when failures exceed the threshold
+
+Minions are resolved once with ResolveTargets and processed in sorted order.
+Returns the result of apply per processed minion; the error wraps ErrorRolloutHalted if the rollout halted
+because of failures or the health check, or is the error of ctx if it expired between waves.
+*/
+func (c *Client) RollingApply(ctx context.Context, target Target, apply func(minion string) error, opts RollingOptions) (map[string]error, error) {
+	minions, err := c.ResolveTargets(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	size := opts.WaveSize
+	if size < 1 {
+		size = 1
+	}
+
+	results := make(map[string]error, len(minions))
+	failures := 0
+	for start, wave := 0, 1; start < len(minions); start, wave = start+size, wave+1 {
+		if start > 0 && opts.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return results, ctx.Err()
+			case <-time.After(opts.Delay):
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		end := start + size
+		if end > len(minions) {
+			end = len(minions)
+		}
+
+		batch := minions[start:end]
+		errs := make([]error, len(batch))
+
+		var wg sync.WaitGroup
+		for i, m := range batch {
+			wg.Add(1)
+			go func(i int, m string) {
+				defer wg.Done()
+				errs[i] = apply(m)
+			}(i, m)
+		}
+		wg.Wait()
+
+		for i, m := range batch {
+			results[m] = errs[i]
+			if errs[i] != nil {
+				failures++
+			}
+		}
+
+		if failures > opts.MaxFailures {
+			return results, fmt.Errorf("wave %d: %d minions failed: %w", wave, failures, ErrorRolloutHalted)
+		}
+
+		if opts.HealthCheck != nil && end < len(minions) {
+			if err := opts.HealthCheck(batch); err != nil {
+				return results, fmt.Errorf("wave %d: health check failed: %s: %w", wave, err, ErrorRolloutHalted)
+			}
+		}
+	}
+
+	return results, nil
+}
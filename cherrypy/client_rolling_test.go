@@ -0,0 +1,43 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollingApply(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_test_ping_compound")
+
+	var waves [][]string
+	res, err := c.RollingApply(context.Background(), ExpressionTarget{Expression: "G@os:Ubuntu and minion*", Type: Compound}, func(minion string) error {
+		return nil
+	}, RollingOptions{
+		HealthCheck: func(minions []string) error {
+			waves = append(waves, minions)
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]error{"minion1": nil, "minion3": nil}, res)
+	assert.Equal(t, [][]string{{"minion1"}}, waves)
+}
+
+func TestRollingApplyHalted(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_test_ping_compound")
+
+	errApply := errors.New("deploy failed")
+	res, err := c.RollingApply(context.Background(), ExpressionTarget{Expression: "G@os:Ubuntu and minion*", Type: Compound}, func(minion string) error {
+		return errApply
+	}, RollingOptions{})
+
+	assert.True(t, errors.Is(err, ErrorRolloutHalted))
+	assert.Equal(t, map[string]error{"minion1": errApply}, res)
+}
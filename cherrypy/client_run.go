@@ -2,8 +2,28 @@ package cherrypy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrorCommandFailed indicates Salt reported the command as unsuccessful
+	ErrorCommandFailed = errors.New("command failed")
+
+	// ErrorReservedArgument indicates an argument of Command collides with a field set by the client
+	ErrorReservedArgument = errors.New("argument name is reserved")
+
+	// ErrorMinionFailed indicates minions reported failures while WithFailFast is enabled
+	ErrorMinionFailed = errors.New("minion failed")
+
+	// ErrorInvalidFunction indicates a function name is not in module.function form while WithFunctionValidation is enabled
+	ErrorInvalidFunction = errors.New("invalid function name, expected module.function")
 )
 
 /*
@@ -19,6 +39,10 @@ const (
 	// LocalClient sends commands to Minions. Equivalent to the salt CLI command.
 	LocalClient CommandClient = "local"
 
+	// LocalBatchClient sends commands to Minions in batches.
+	// Equivalent to the salt CLI command with --batch-size option.
+	LocalBatchClient = "local_batch"
+
 	// RunnerClient invokes runner modules on the Master.
 	// Equivalent to the salt-run CLI command.
 	RunnerClient = "runner"
@@ -26,20 +50,253 @@ const (
 	// WheelClient invokes wheel modules on the Master.
 	// Wheel modules do not have a direct CLI equivalent
 	WheelClient = "wheel"
+
+	// WheelAsyncClient invokes wheel modules on the Master asynchronously.
+	// Returns the job id immediately instead of the result.
+	WheelAsyncClient = "wheel_async"
 )
 
-// Command to send to Run endpont
+/*
+Command to send to Run endpont
+
+Arguments are sent along with the fields set by the client; therefore they can not be named
+client, fun, username, password, eauth, full_return (except for wheel clients) or tgt and tgt_type
+when Target is set.
+
+Command is encoded to JSON in Salt's low data format without the credentials,
+using client, tgt, tgt_type and fun fields next to the arguments.
+*/
 type Command struct {
-	Client     CommandClient
-	Target     Target
-	Function   string
-	Arguments  map[string]interface{}
+	Client    CommandClient
+	Target    Target
+	Function  string
+	Arguments map[string]interface{}
+
+	// Timeout overrides how long the master waits for minions to return, sent as timeout in seconds.
+	// Applies to local clients only; master's timeout applies if zero.
+	Timeout time.Duration
+}
+
+// MarshalJSON encodes the command in Salt's low data format
+func (c Command) MarshalJSON() ([]byte, error) {
+	d := c.lowData()
+	for k, v := range c.Arguments {
+		if _, ok := d[k]; !ok {
+			d[k] = v
+		}
+	}
+
+	return json.Marshal(d)
+}
+
+// UnmarshalJSON decodes the command from Salt's low data format
+func (c *Command) UnmarshalJSON(b []byte) error {
+	var d map[string]interface{}
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	client, _ := d["client"].(string)
+	fun, _ := d["fun"].(string)
+	*c = Command{
+		Client:   CommandClient(client),
+		Function: fun,
+	}
+
+	tgtType, _ := d["tgt_type"].(string)
+	delimiter, _ := d["delimiter"].(string)
+	target, err := targetJSON{Target: d["tgt"], TargetType: tgtType, Delimiter: delimiter}.parse()
+	if err != nil {
+		return err
+	}
+
+	c.Target = target
+
+	if timeout, ok := d["timeout"].(float64); ok {
+		c.Timeout = time.Duration(timeout * float64(time.Second))
+		delete(d, "timeout")
+	}
+
+	for _, k := range []string{"client", "fun", "tgt", "tgt_type", "delimiter"} {
+		delete(d, k)
+	}
+
+	if len(d) > 0 {
+		c.Arguments = d
+	}
+
+	return nil
+}
+
+// lowData returns the fields of the command sent to Salt other than arguments and credentials
+func (c Command) lowData() map[string]interface{} {
+	d := make(map[string]interface{})
+	d["client"] = c.Client
+	d["fun"] = c.Function
+
+	if c.Target != nil {
+		d["tgt"] = c.Target.GetTarget()
+		d["tgt_type"] = c.Target.GetType()
+
+		if delimiter := targetDelimiter(c.Target); delimiter != "" {
+			d["delimiter"] = delimiter
+		}
+	}
+
+	if c.Timeout > 0 {
+		d["timeout"] = saltSeconds(c.Timeout)
+	}
+
+	return d
 }
 
 type runResponse struct {
 	Return []interface{} `json:"return"`
 }
 
+// BatchResult contains the result of a single command executed by RunBatch
+type BatchResult struct {
+	Result interface{} `json:"result"`
+	Error  error       `json:"-"`
+}
+
+type localReturn struct {
+	ID         string          `json:"jid"`
+	Return     json.RawMessage `json:"ret"`
+	ReturnCode int             `json:"retcode"`
+
+	// Late indicates the return was recovered from the job cache, see WithLateReturns
+	Late bool `json:"-"`
+}
+
+// UnmarshalJSON decodes the return of a minion with or without the envelope added by full_return
+func (r *localReturn) UnmarshalJSON(b []byte) error {
+	var env map[string]json.RawMessage
+	if json.Unmarshal(b, &env) == nil && env["ret"] != nil && (env["retcode"] != nil || env["jid"] != nil) {
+		type plain localReturn
+		return json.Unmarshal(b, (*plain)(r))
+	}
+
+	*r = localReturn{Return: append(json.RawMessage(nil), b...)}
+	return nil
+}
+
+// LocalResult contains returns of a function executed on minions and their retcodes, keyed by minion id
+type LocalResult struct {
+	Returns     map[string]interface{}
+	ReturnCodes map[string]int
+
+	// Late contains minions whose returns were recovered from the job cache after the call, see WithLateReturns
+	Late []string
+}
+
+/*
+ExitCode returns the exit code salt CLI reports for the result with --retcode-passthrough
+
+The highest retcode of the minions is returned; 0 if all minions succeeded.
+Minions which did not respond are not included in the result and do not affect the exit code.
+*/
+func (r *LocalResult) ExitCode() int {
+	return exitCode(r.ReturnCodes)
+}
+
+// exitCode returns the highest of the retcodes, like salt CLI does with --retcode-passthrough
+func exitCode(retcodes map[string]int) int {
+	code := 0
+	for _, rc := range retcodes {
+		if rc > code {
+			code = rc
+		}
+	}
+
+	return code
+}
+
+// newLocalResult decodes the returns of minions
+func newLocalResult(res map[string]localReturn) (*LocalResult, error) {
+	result := &LocalResult{
+		Returns:     make(map[string]interface{}, len(res)),
+		ReturnCodes: make(map[string]int, len(res)),
+	}
+
+	for m, r := range res {
+		var v interface{}
+		if err := json.Unmarshal(r.Return, &v); err != nil {
+			return nil, fmt.Errorf("%s: unexpected return: %w", m, err)
+		}
+
+		result.Returns[m] = v
+		result.ReturnCodes[m] = r.ReturnCode
+		if r.Late {
+			result.Late = append(result.Late, m)
+		}
+	}
+
+	sort.Strings(result.Late)
+	return result, nil
+}
+
+type localResponse struct {
+	Return []map[string]localReturn `json:"return"`
+}
+
+type runnerData struct {
+	ID       string          `json:"jid"`
+	Function string          `json:"fun"`
+	Return   json.RawMessage `json:"return"`
+	Success  bool            `json:"success"`
+}
+
+/*
+UnmarshalJSON decodes the result of a runner or wheel function from any of the envelopes used by Salt
+
+Results might be wrapped in an event like {"tag": ..., "data": {...}}, returned with the job details
+like {"fun": ..., "return": ..., "success": ...} or returned as they are; success is assumed when
+the envelope does not report it.
+*/
+func (d *runnerData) UnmarshalJSON(b []byte) error {
+	var env map[string]json.RawMessage
+	if json.Unmarshal(b, &env) == nil {
+		if data, ok := env["data"]; ok && env["tag"] != nil {
+			return d.UnmarshalJSON(data)
+		}
+
+		if env["return"] != nil && env["fun"] != nil {
+			var v struct {
+				ID       string          `json:"jid"`
+				Function string          `json:"fun"`
+				Return   json.RawMessage `json:"return"`
+				Success  *bool           `json:"success"`
+			}
+			if err := json.Unmarshal(b, &v); err != nil {
+				return err
+			}
+
+			*d = runnerData{
+				ID:       v.ID,
+				Function: v.Function,
+				Return:   v.Return,
+				Success:  v.Success == nil || *v.Success,
+			}
+			return nil
+		}
+	}
+
+	*d = runnerData{Return: append(json.RawMessage(nil), b...), Success: true}
+	return nil
+}
+
+type runnerResponse struct {
+	Return []runnerData `json:"return"`
+}
+
+type wheelAsyncResponse struct {
+	Return []struct {
+		Tag string `json:"tag"`
+		ID  string `json:"jid"`
+	} `json:"return"`
+}
+
 /*
 RunCommand runs a command on master using Run endpoint
 
@@ -64,47 +321,458 @@ RunCommands runs multiple commands on master using Run endpoint
 https://docs.saltstack.com/en/latest/ref/netapi/all/salt.netapi.rest_cherrypy.html#salt.netapi.rest_cherrypy.app.Run
 */
 func (c *Client) RunCommands(ctx context.Context, cmds []Command) ([]interface{}, error) {
+	if len(Kwargs(ctx)) > 0 {
+		var err error
+		if cmds, err = commandsWithKwargs(ctx, cmds); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp runResponse
+	if err := c.runCommands(ctx, cmds, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Return, nil
+}
+
+/*
+RunBatch runs commands concurrently using a separate request to Run endpoint for each command
+
+At most workers commands are executed at the same time. Results are returned in the order of cmds
+along with the error of each command. Returned error indicates that at least one of the commands failed.
+
+Unlike RunCommands, a slow command does not delay the others.
+*/
+func (c *Client) RunBatch(ctx context.Context, cmds []Command, workers int) ([]BatchResult, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]BatchResult, len(cmds))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				res, err := c.RunCommand(ctx, cmds[i])
+				results[i] = BatchResult{Result: res, Error: err}
+			}
+		}()
+	}
+
+	for i := range cmds {
+		queue <- i
+	}
+
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d commands failed", failed, len(cmds))
+	}
+
+	return results, nil
+}
+
+/*
+RunLocal executes the function on targeted minions synchronously and returns their returns and retcodes
+
+Keyword arguments are handled like for the other helpers, see WithKwargs() and WithLegacyKwargs();
+with WithFailFast() an error is returned if any minion fails. Use ExitCode() of the result to derive
+the exit status of a program wrapping the command.
+
+https://docs.saltstack.com/en/latest/ref/clients/index.html#salt.client.LocalClient.cmd
+*/
+func (c *Client) RunLocal(ctx context.Context, target Target, fun string, arg []interface{}, kwarg map[string]interface{}) (*LocalResult, error) {
+	res, err := c.runLocal(ctx, target, fun, arg, kwarg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLocalResult(res)
+}
+
+// runLocal executes a function on targeted minions and returns the raw returns per minion
+func (c *Client) runLocal(ctx context.Context, target Target, fun string, arg []interface{}, kwarg map[string]interface{}) (map[string]localReturn, error) {
+	res, err := c.runLocalOnce(ctx, target, fun, arg, kwarg)
+	if err != nil {
+		return nil, err
+	}
+
+	if n := retries(ctx); n > 0 {
+		c.retryLocal(ctx, res, n, fun, arg, kwarg)
+	}
+
+	if c.failFast {
+		if err := failedMinions(res); err != nil {
+			return nil, fmt.Errorf("%s: %w", fun, err)
+		}
+	}
+
+	return res, nil
+}
+
+/*
+retryLocal re-runs the function up to n times on minions of res which failed or did not return, see WithRetries()
+
+Minions which did not return are found by looking up the job; if no minion returned, the job is not known
+and the command is not retried. Failing lookups and attempts are logged and stop retrying, leaving res as gathered.
+*/
+func (c *Client) retryLocal(ctx context.Context, res map[string]localReturn, n int, fun string, arg []interface{}, kwarg map[string]interface{}) {
+	var jid string
+	for _, r := range res {
+		if r.ID != "" {
+			jid = r.ID
+			break
+		}
+	}
+
+	if jid == "" {
+		return
+	}
+
+	details, err := c.Job(ctx, jid)
+	if err != nil {
+		log.Printf("[DEBUG] Lookup of minions of job %s failed: %s", jid, err)
+		return
+	}
+
+	targeted := details.Minions
+	for attempt := 0; attempt < n; attempt++ {
+		var retry []string
+		for _, m := range targeted {
+			if r, ok := res[m]; !ok || r.ReturnCode != 0 {
+				retry = append(retry, m)
+			}
+		}
+
+		if len(retry) == 0 {
+			return
+		}
+
+		sort.Strings(retry)
+		log.Printf("[DEBUG] Retrying %s on %s", fun, strings.Join(retry, ", "))
+		again, err := c.runLocalOnce(ctx, ListTarget{Targets: retry}, fun, arg, kwarg)
+		if err != nil {
+			log.Printf("[DEBUG] Retry of %s failed: %s", fun, err)
+			return
+		}
+
+		for m, r := range again {
+			res[m] = r
+		}
+
+		targeted = retry
+	}
+}
+
+// runLocalOnce executes a function on targeted minions once, adding late returns if WithLateReturns is set
+func (c *Client) runLocalOnce(ctx context.Context, target Target, fun string, arg []interface{}, kwarg map[string]interface{}) (map[string]localReturn, error) {
+	cmd := Command{
+		Client:    LocalClient,
+		Target:    target,
+		Function:  fun,
+		Arguments: make(map[string]interface{}),
+	}
+
+	kwarg = mergeKwargs(ctx, kwarg)
+	if c.legacyKwargs && len(kwarg) > 0 {
+		var err error
+		if arg, err = legacyArgs(arg, kwarg); err != nil {
+			return nil, err
+		}
+
+		kwarg = nil
+	}
+
+	if len(arg) > 0 {
+		cmd.Arguments["arg"] = arg
+	}
+
+	if len(kwarg) > 0 {
+		cmd.Arguments["kwarg"] = kwarg
+	}
+
+	var resp localResponse
+	if err := c.runCommands(ctx, []Command{cmd}, &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Return) != 1 {
+		return nil, fmt.Errorf("expected 1 results but received %d", len(resp.Return))
+	}
+
+	res := resp.Return[0]
+	if c.lateReturns > 0 {
+		c.lookupLateReturns(ctx, res)
+	}
+
+	return res, nil
+}
+
+/*
+lookupLateReturns adds returns of targeted minions missing from res, which reached the job cache
+after the master stopped gathering returns
+
+The job is looked up right away and, if targeted minions are still missing, once more after the delay set
+with WithLateReturns. Failing or cancelled lookups are logged and leave res as gathered.
+*/
+func (c *Client) lookupLateReturns(ctx context.Context, res map[string]localReturn) {
+	var jid string
+	for _, r := range res {
+		if r.ID != "" {
+			jid = r.ID
+			break
+		}
+	}
+
+	// without any return the id of the job is not known
+	if jid == "" {
+		return
+	}
+
+	details, err := c.Job(ctx, jid)
+	if err != nil {
+		log.Printf("[DEBUG] Lookup of late returns of job %s failed: %s", jid, err)
+		return
+	}
+
+	if addLateReturns(res, jid, details) == 0 {
+		return
+	}
+
+	timer := time.NewTimer(c.lateReturns)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	details, err = c.Job(ctx, jid)
+	if err != nil {
+		log.Printf("[DEBUG] Lookup of late returns of job %s failed: %s", jid, err)
+		return
+	}
+
+	addLateReturns(res, jid, details)
+}
+
+// addLateReturns adds returns of the job details missing from res and returns the number of targeted minions still missing
+func addLateReturns(res map[string]localReturn, jid string, details *JobDetails) int {
+	missing := 0
+	for _, m := range details.Minions {
+		if _, ok := res[m]; ok {
+			continue
+		}
+
+		v, ok := details.Returns[m]
+		if !ok {
+			missing++
+			continue
+		}
+
+		raw, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+
+		res[m] = localReturn{ID: jid, Return: raw, ReturnCode: details.ReturnCodes[m], Late: true}
+	}
+
+	return missing
+}
+
+// failedMinions returns an error naming the minions which returned a non-zero retcode, if any
+func failedMinions(res map[string]localReturn) error {
+	var failed []string
+	for k, r := range res {
+		if r.ReturnCode != 0 {
+			failed = append(failed, k)
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	sort.Strings(failed)
+	return fmt.Errorf("%d of %d minions failed (%s): %w", len(failed), len(res), strings.Join(failed, ", "), ErrorMinionFailed)
+}
+
+/*
+WheelAsync invokes a wheel function asynchronously and returns the job id without waiting for the result
+
+Suitable for long running wheel functions which would otherwise exceed timeouts of the request.
+Progress can be followed on the event bus with tag salt/wheel/<jid>; the result can be retrieved
+with Job() once finished, where IsRunner() reports true and RunnerReturn() returns the result.
+*/
+func (c *Client) WheelAsync(ctx context.Context, fun string, kwargs map[string]interface{}) (string, error) {
+	cmd := Command{
+		Client:    WheelAsyncClient,
+		Function:  fun,
+		Arguments: kwargs,
+	}
+
+	var resp wheelAsyncResponse
+	if err := c.runCommands(ctx, []Command{cmd}, &resp); err != nil {
+		return "", err
+	}
+
+	if len(resp.Return) != 1 {
+		return "", fmt.Errorf("expected 1 results but received %d", len(resp.Return))
+	}
+
+	return resp.Return[0].ID, nil
+}
+
+// runRunner executes a runner function and decodes its return into v
+func (c *Client) runRunner(ctx context.Context, fun string, args map[string]interface{}, v interface{}) error {
+	cmd := Command{
+		Client:    RunnerClient,
+		Function:  fun,
+		Arguments: args,
+	}
+
+	var resp runnerResponse
+	if err := c.runCommands(ctx, []Command{cmd}, &resp); err != nil {
+		return err
+	}
+
+	if len(resp.Return) != 1 {
+		return fmt.Errorf("expected 1 results but received %d", len(resp.Return))
+	}
+
+	return resp.Return[0].decode(v)
+}
+
+// runWheel executes a wheel function and decodes its return into v
+func (c *Client) runWheel(ctx context.Context, fun string, args map[string]interface{}, v interface{}) error {
+	cmd := Command{
+		Client:    WheelClient,
+		Function:  fun,
+		Arguments: args,
+	}
+
+	var resp runnerResponse
+	if err := c.runCommands(ctx, []Command{cmd}, &resp); err != nil {
+		return err
+	}
+
+	if len(resp.Return) != 1 {
+		return fmt.Errorf("expected 1 results but received %d", len(resp.Return))
+	}
+
+	return resp.Return[0].decode(v)
+}
+
+func (d runnerData) decode(v interface{}) error {
+	if !d.Success {
+		return fmt.Errorf("%s: %w: %s", d.Function, ErrorCommandFailed, d.Return)
+	}
+
+	return json.Unmarshal(d.Return, v)
+}
+
+func (c *Client) runCommands(ctx context.Context, cmds []Command, v interface{}) error {
 	r := make([]map[string]interface{}, len(cmds))
-	for i, v := range cmds {
-		d := make(map[string]interface{})
-		
-		if v.Arguments != nil {
-			for k, a := range v.Arguments {
-				d[k] = a
+	for i, cmd := range cmds {
+		d := cmd.lowData()
+		if c.checkFunctions {
+			fun, err := normalizeFunction(cmd.Function)
+			if err != nil {
+				return err
 			}
+
+			d["fun"] = fun
 		}
 
-		d["client"] = v.Client
-		d["fun"] = v.Function
 		d["username"] = c.eauth.Username
 		d["password"] = c.eauth.Password
 		d["eauth"] = c.eauth.Backend
 
-		if v.Target != nil {
-			d["tgt"] = v.Target.GetTarget()
-			d["tgt_type"] = v.Target.GetType()
-		}
-
 		// wheel throws following error if full_return is sent as a seperate argument
 		// TypeError: call_func() got multiple values for keyword argument 'full_return'
-		if v.Client != WheelClient {
+		if cmd.Client != WheelClient && cmd.Client != WheelAsyncClient {
 			d["full_return"] = true
 		}
-		
+
+		for k, a := range cmd.Arguments {
+			if _, ok := d[k]; ok {
+				return fmt.Errorf("%s: %w, following names are set by the client: %s", k, ErrorReservedArgument, reservedArguments(d))
+			}
+
+			d[k] = a
+		}
+
 		r[i] = d
 	}
 
 	req, err := c.newRequest(ctx, "POST", "run", r)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	log.Println("[DEBUG] Sending run jobs request")
-	var resp runResponse
-	_, err = c.do(req, &resp)
-	if err != nil {
-		return nil, err
+	_, err = c.do(req, v)
+	return err
+}
+
+// commandsWithKwargs returns copies of cmds with keyword arguments carried by ctx added to local commands
+func commandsWithKwargs(ctx context.Context, cmds []Command) ([]Command, error) {
+	res := make([]Command, len(cmds))
+	for i, cmd := range cmds {
+		res[i] = cmd
+		if cmd.Client != LocalClient {
+			continue
+		}
+
+		var kwarg map[string]interface{}
+		if v, ok := cmd.Arguments["kwarg"]; ok {
+			if kwarg, ok = v.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("%s: kwarg must be a map to add keyword arguments of the context", cmd.Function)
+			}
+		}
+
+		res[i].Arguments = make(map[string]interface{}, len(cmd.Arguments)+1)
+		for k, v := range cmd.Arguments {
+			res[i].Arguments[k] = v
+		}
+		res[i].Arguments["kwarg"] = mergeKwargs(ctx, kwarg)
 	}
 
-	return resp.Return, nil
+	return res, nil
+}
+
+func reservedArguments(d map[string]interface{}) string {
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// normalizeFunction trims the function name and checks it consists of a module and a function separated by a dot
+func normalizeFunction(fun string) (string, error) {
+	name := strings.TrimSpace(fun)
+	parts := strings.Split(name, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(name, " \t\n") {
+		return "", fmt.Errorf("%q: %w", fun, ErrorInvalidFunction)
+	}
+
+	return name, nil
 }
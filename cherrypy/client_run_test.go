@@ -2,7 +2,12 @@ package cherrypy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -48,6 +53,156 @@ func TestRunLocalCommands(t *testing.T) {
 	assert.Equal(t, 2, len(res))
 }
 
+func TestRunLocal(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_service_restart")
+
+	res, err := c.RunLocal(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "service.restart", []interface{}{"nginx"}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, true, res.Returns["minion1"])
+	assert.Equal(t, map[string]int{"minion1": 0, "minion3": 1}, res.ReturnCodes)
+	assert.Equal(t, 1, res.ExitCode())
+}
+
+func TestRunLocalWithLateReturns(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_cmd_run_straggler")
+	tester.Setup(t, "jobs_get", "straggler")
+
+	c := newClient(t, tester, WithLateReturns(time.Millisecond))
+	c.Token = testToken
+	res, err := c.RunLocal(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "cmd.run", []interface{}{"uptime"}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(res.Returns))
+	assert.Contains(t, res.Returns["minion2"], "up 9 days")
+	assert.Equal(t, []string{"minion2"}, res.Late)
+}
+
+func TestRunLocalWithLateReturnsAfterDelay(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_cmd_run_straggler")
+	s, err := tester.Scenario("jobs_get", "straggler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lookups := 0
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		lookups++
+		w.Header().Set("Content-Type", "application/json")
+		if lookups == 1 {
+			// minion2 did not reach the job cache yet
+			w.Write([]byte(`{"info": [{"jid": "20200214101500112233", "Function": "cmd.run", "Minions": ["minion1", "minion2"],
+				"Result": {"minion1": {"return": "up 3 days", "retcode": 0, "success": true}}}], "return": [{"minion1": "up 3 days"}]}`))
+			return
+		}
+
+		io.Copy(w, s.Response.Body)
+	})
+
+	c := newClient(t, tester, WithLateReturns(10*time.Millisecond))
+	c.Token = testToken
+	res, err := c.RunLocal(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "cmd.run", []interface{}{"uptime"}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, lookups)
+	assert.Contains(t, res.Returns["minion2"], "up 9 days")
+	assert.Equal(t, []string{"minion2"}, res.Late)
+}
+
+func TestRunLocalWithLateReturnsAllReturned(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+	run, err := tester.Scenario("run", "local_cmd_run_straggler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := tester.Scenario("jobs_get", "straggler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester.Do(run.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"return": [{"minion1": {"jid": "20200214101500112233", "retcode": 0, "ret": "up 3 days"},
+			"minion2": {"jid": "20200214101500112233", "retcode": 0, "ret": "up 9 days"}}]}`))
+	})
+
+	lookups := 0
+	tester.Do(job.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		lookups++
+		w.Header().Set("Content-Type", "application/json")
+		io.Copy(w, job.Response.Body)
+	})
+
+	c := newClient(t, tester, WithLateReturns(time.Hour))
+	c.Token = testToken
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	res, err := c.RunLocal(ctx, ExpressionTarget{Expression: "minion*", Type: Glob}, "cmd.run", []interface{}{"uptime"}, nil)
+
+	assert.NoError(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Equal(t, 1, lookups)
+	assert.Equal(t, 2, len(res.Returns))
+	assert.Empty(t, res.Late)
+}
+
+func TestRunLocalWithRetries(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	run, err := tester.Scenario("run", "local_cmd_run_straggler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var targets []interface{}
+	tester.Do(run.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		var low []map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&low); err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, low[0]["tgt"])
+
+		w.Header().Set("Content-Type", "application/json")
+		switch len(targets) {
+		case 1:
+			w.Write([]byte(`{"return": [{"minion1": {"jid": "20200214111500000001", "retcode": 0, "ret": "ok"},
+				"minion2": {"jid": "20200214111500000001", "retcode": 1, "ret": "curl: (6) Could not resolve host"}}]}`))
+		case 2:
+			w.Write([]byte(`{"return": [{"minion2": {"jid": "20200214111500000002", "retcode": 1, "ret": "curl: (6) Could not resolve host"}}]}`))
+		default:
+			w.Write([]byte(`{"return": [{"minion2": {"jid": "20200214111500000003", "retcode": 0, "ret": "ok"},
+				"minion3": {"jid": "20200214111500000003", "retcode": 0, "ret": "ok"}}]}`))
+		}
+	})
+
+	tester.Do("/jobs/20200214111500000001", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"info": [{"jid": "20200214111500000001", "Function": "cmd.run", "Minions": ["minion1", "minion2", "minion3"],
+			"Result": {"minion1": {"return": "ok", "retcode": 0, "success": true}}}], "return": [{"minion1": "ok"}]}`))
+	})
+
+	ctx := WithRetries(context.Background(), 3)
+	res, err := c.RunLocal(ctx, ExpressionTarget{Expression: "minion*", Type: Glob}, "cmd.run", []interface{}{"curl -sf https://repo"}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		"minion*",
+		[]interface{}{"minion2", "minion3"},
+		[]interface{}{"minion2", "minion3"},
+	}, targets)
+	assert.Equal(t, map[string]interface{}{"minion1": "ok", "minion2": "ok", "minion3": "ok"}, res.Returns)
+	assert.Equal(t, 0, res.ExitCode())
+}
+
 func TestRunWheelCommand(t *testing.T) {
 	tester, c := setup(t)
 	defer tester.Close()
@@ -64,6 +219,175 @@ func TestRunWheelCommand(t *testing.T) {
 	assert.NotNil(t, res)
 }
 
+func TestWheelAsync(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "wheel_async_key_gen_accept")
+
+	res, err := c.WheelAsync(context.Background(), "key.gen_accept", map[string]interface{}{"id_": "minion4"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "20200212094411051434", res)
+}
+
+func TestRunCommandWithReservedArgument(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+
+	cmd := Command{
+		Client:    "local",
+		Target:    ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function:  "test.ping",
+		Arguments: map[string]interface{}{"tgt": "minion2"},
+	}
+
+	_, err := c.RunCommand(context.Background(), cmd)
+
+	assert.True(t, errors.Is(err, ErrorReservedArgument))
+	assert.Contains(t, err.Error(), "client, eauth, full_return, fun, password, tgt, tgt_type, username")
+}
+
+func TestRunBatch(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_success")
+
+	cmd := Command{
+		Client:   "local",
+		Target:   ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function: "test.ping",
+	}
+
+	invalid := cmd
+	invalid.Arguments = map[string]interface{}{"fun": "test.ping"}
+
+	res, err := c.RunBatch(context.Background(), []Command{cmd, invalid, cmd}, 2)
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, len(res))
+	assert.NoError(t, res[0].Error)
+	assert.NotNil(t, res[0].Result)
+	assert.True(t, errors.Is(res[1].Error, ErrorReservedArgument))
+	assert.Nil(t, res[1].Result)
+	assert.NoError(t, res[2].Error)
+	assert.NotNil(t, res[2].Result)
+}
+
+func TestCommandJSON(t *testing.T) {
+	cmd := Command{
+		Client:    LocalClient,
+		Target:    &ListTarget{Targets: []string{"minion1", "minion2"}},
+		Function:  "test.arg",
+		Arguments: map[string]interface{}{"arg": []interface{}{"a"}},
+	}
+
+	b, err := json.Marshal(cmd)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"client":"local","tgt":["minion1","minion2"],"tgt_type":"list","fun":"test.arg","arg":["a"]}`, string(b))
+
+	var res Command
+	assert.NoError(t, json.Unmarshal(b, &res))
+	assert.Equal(t, cmd, res)
+}
+
+func TestCommandJSONWithTimeout(t *testing.T) {
+	cmd := Command{
+		Client:   LocalClient,
+		Target:   &ExpressionTarget{Expression: "minion*", Type: Glob},
+		Function: "test.ping",
+		Timeout:  90 * time.Second,
+	}
+
+	b, err := json.Marshal(cmd)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"client":"local","tgt":"minion*","tgt_type":"glob","fun":"test.ping","timeout":90}`, string(b))
+
+	var res Command
+	assert.NoError(t, json.Unmarshal(b, &res))
+	assert.Equal(t, cmd, res)
+}
+
+func TestCommandJSONWithDelimiter(t *testing.T) {
+	cmd := Command{
+		Client:   LocalClient,
+		Target:   &ExpressionTarget{Expression: "ip6_interfaces|eth0|fe80::1", Type: Grain, Delimiter: "|"},
+		Function: "test.ping",
+	}
+
+	b, err := json.Marshal(cmd)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"client":"local","tgt":"ip6_interfaces|eth0|fe80::1","tgt_type":"grain","delimiter":"|","fun":"test.ping"}`, string(b))
+
+	var res Command
+	assert.NoError(t, json.Unmarshal(b, &res))
+	assert.Equal(t, cmd, res)
+}
+
+func TestCommandJSONWithInvalidListTarget(t *testing.T) {
+	var res Command
+	err := json.Unmarshal([]byte(`{"client":"local","tgt":[1],"tgt_type":"list","fun":"test.ping"}`), &res)
+
+	assert.Error(t, err)
+}
+
+func TestRunnerDataEnvelopes(t *testing.T) {
+	cases := map[string]string{
+		"event":  `{"tag":"salt/wheel/1","data":{"jid":"1","fun":"wheel.key.list_all","return":{"a":1},"success":true}}`,
+		"job":    `{"jid":"1","fun":"runner.manage.up","return":{"a":1},"success":true}`,
+		"nested": `{"tag":"salt/run/1/ret","data":{"tag":"salt/run/1/ret","data":{"fun":"runner.manage.up","return":{"a":1}}}}`,
+		"plain":  `{"a":1}`,
+	}
+
+	for name, input := range cases {
+		var d runnerData
+		assert.NoError(t, json.Unmarshal([]byte(input), &d), name)
+		assert.True(t, d.Success, name)
+
+		var v map[string]int
+		assert.NoError(t, d.decode(&v), name)
+		assert.Equal(t, map[string]int{"a": 1}, v, name)
+	}
+
+	var d runnerData
+	assert.NoError(t, json.Unmarshal([]byte(`{"data":{"fun":"runner.x","return":"boom","success":false},"tag":"salt/run/1/ret"}`), &d))
+	assert.True(t, errors.Is(d.decode(new(interface{})), ErrorCommandFailed))
+}
+
+func TestLocalReturnEnvelopes(t *testing.T) {
+	var r map[string]localReturn
+	input := `{"minion1":{"jid":"1","ret":true,"retcode":0},"minion2":{"ret":"fail","retcode":1},"minion3":true}`
+	assert.NoError(t, json.Unmarshal([]byte(input), &r))
+
+	assert.Equal(t, localReturn{ID: "1", Return: json.RawMessage(`true`)}, r["minion1"])
+	assert.Equal(t, localReturn{Return: json.RawMessage(`"fail"`), ReturnCode: 1}, r["minion2"])
+	assert.Equal(t, localReturn{Return: json.RawMessage(`true`)}, r["minion3"])
+}
+
+func TestNormalizeFunction(t *testing.T) {
+	fun, err := normalizeFunction(" test.ping\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "test.ping", fun)
+
+	for _, name := range []string{"", "test", "test.", ".ping", "test..ping", "test.ping.x", "test. ping"} {
+		_, err := normalizeFunction(name)
+		assert.True(t, errors.Is(err, ErrorInvalidFunction), name)
+	}
+}
+
+func TestRunCommandWithInvalidFunction(t *testing.T) {
+	tester, _ := setup(t)
+	defer tester.Close()
+
+	c := newClient(t, tester, WithFunctionValidation())
+	_, err := c.RunCommand(context.Background(), Command{
+		Client:   LocalClient,
+		Target:   ExpressionTarget{Expression: "*", Type: Glob},
+		Function: "testping",
+	})
+
+	assert.True(t, errors.Is(err, ErrorInvalidFunction))
+}
+
 // TODO: Add runner test
 // TODO: Add test with arguments
 // TODO: Add test with kw arguments
@@ -0,0 +1,30 @@
+package cherrypy
+
+import (
+	"context"
+	"encoding/json"
+)
+
+/*
+RefreshPillar asks targeted minions to refresh their pillar data with saltutil.refresh_pillar
+
+Minions keep using cached pillar data until refreshed, so this should be called after
+pillar data is changed on the master. Returns whether the refresh succeeded per minion;
+minions which did not respond are not included.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.saltutil.html#salt.modules.saltutil.refresh_pillar
+*/
+func (c *Client) RefreshPillar(ctx context.Context, target Target) (map[string]bool, error) {
+	res, err := c.runLocal(ctx, target, "saltutil.refresh_pillar", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed := make(map[string]bool, len(res))
+	for k, r := range res {
+		var ok bool
+		refreshed[k] = r.ReturnCode == 0 && json.Unmarshal(r.Return, &ok) == nil && ok
+	}
+
+	return refreshed, nil
+}
@@ -0,0 +1,19 @@
+package cherrypy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshPillar(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_saltutil_refresh_pillar")
+
+	res, err := c.RefreshPillar(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"minion1": true, "minion3": false}, res)
+}
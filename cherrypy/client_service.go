@@ -0,0 +1,98 @@
+package cherrypy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+ServiceStart starts the service on targeted minions with service.start
+
+Returns an error per minion which is nil if the service was started; minions which did not respond are not included.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.service.html
+*/
+func (c *Client) ServiceStart(ctx context.Context, target Target, name string) (map[string]error, error) {
+	return c.serviceAction(ctx, target, "service.start", name)
+}
+
+/*
+ServiceStop stops the service on targeted minions with service.stop
+
+Returns an error per minion which is nil if the service was stopped; minions which did not respond are not included.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.service.html
+*/
+func (c *Client) ServiceStop(ctx context.Context, target Target, name string) (map[string]error, error) {
+	return c.serviceAction(ctx, target, "service.stop", name)
+}
+
+/*
+ServiceRestart restarts the service on targeted minions with service.restart
+
+Returns an error per minion which is nil if the service was restarted; minions which did not respond are not included.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.service.html
+*/
+func (c *Client) ServiceRestart(ctx context.Context, target Target, name string) (map[string]error, error) {
+	return c.serviceAction(ctx, target, "service.restart", name)
+}
+
+// ServiceStatuses contains whether a service is running per minion
+type ServiceStatuses struct {
+	Running map[string]bool
+
+	// Errors contains minions failing the command; minions which did not respond are not included in either
+	Errors map[string]error
+}
+
+/*
+ServiceStatus checks whether the service is running on targeted minions with service.status
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.service.html
+*/
+func (c *Client) ServiceStatus(ctx context.Context, target Target, name string) (*ServiceStatuses, error) {
+	res, err := c.runLocal(ctx, target, "service.status", []interface{}{name}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ServiceStatuses{
+		Running: make(map[string]bool),
+		Errors:  make(map[string]error),
+	}
+
+	for k, r := range res {
+		var running bool
+		if r.ReturnCode != 0 || json.Unmarshal(r.Return, &running) != nil {
+			result.Errors[k] = fmt.Errorf("service.status: %w: %s", ErrorCommandFailed, r.Return)
+			continue
+		}
+
+		result.Running[k] = running
+	}
+
+	return result, nil
+}
+
+// serviceAction runs a service function which returns true on success and reports the failures per minion
+func (c *Client) serviceAction(ctx context.Context, target Target, fun string, name string) (map[string]error, error) {
+	res, err := c.runLocal(ctx, target, fun, []interface{}{name}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make(map[string]error, len(res))
+	for k, r := range res {
+		var ok bool
+		if r.ReturnCode != 0 || json.Unmarshal(r.Return, &ok) != nil || !ok {
+			errs[k] = fmt.Errorf("%s: %w: %s", fun, ErrorCommandFailed, r.Return)
+			continue
+		}
+
+		errs[k] = nil
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,36 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceRestart(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_service_restart")
+
+	res, err := c.ServiceRestart(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "nginx")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(res))
+	assert.NoError(t, res["minion1"])
+	assert.True(t, errors.Is(res["minion3"], ErrorCommandFailed))
+	assert.Contains(t, res["minion3"].Error(), "Unit nginx.service not found")
+}
+
+func TestServiceStatus(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_service_status")
+
+	res, err := c.ServiceStatus(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "nginx")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"minion1": true, "minion3": false}, res.Running)
+	assert.Equal(t, 1, len(res.Errors))
+	assert.True(t, errors.Is(res.Errors["minion2"], ErrorCommandFailed))
+}
@@ -0,0 +1,354 @@
+package cherrypy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StateReturn is the return of a single state executed on a minion
+type StateReturn struct {
+	Name string `json:"name"`
+
+	// Result is nil if the state would make changes when executed with test=True
+	Result  *bool                  `json:"result"`
+	Comment string                 `json:"comment"`
+	Changes map[string]interface{} `json:"changes"`
+
+	// RunNum is the execution order of the state
+	RunNum int `json:"__run_num__"`
+
+	// ID is the id declaration of the state and SLS the SLS file declaring it; empty for states not declared in files
+	ID  string `json:"__id__"`
+	SLS string `json:"__sls__"`
+}
+
+// StateID identifies a state executed on a minion by its key in StateResult.States
+type StateID struct {
+	Minion string
+	Key    string
+}
+
+/*
+RenderError is reported for a minion whose SLS files failed to render, e.g. because of a Jinja syntax error
+
+Salt returns the messages of such failures instead of states; those reporting the failed rendering are joined
+with new lines in Message. RenderError wraps ErrorCommandFailed.
+*/
+type RenderError struct {
+	Minion  string
+	Message string
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("%s: states failed to render: %s", e.Minion, e.Message)
+}
+
+func (e *RenderError) Unwrap() error {
+	return ErrorCommandFailed
+}
+
+// StateResult contains returns of state functions per minion
+type StateResult struct {
+	// States contains returns keyed by the state key reported by Salt (e.g.: pkg_|-nginx_|-nginx_|-installed) per minion
+	States map[string]map[string]StateReturn
+
+	// Errors contains minions which did not execute states; *RenderError if their SLS files failed to render
+	Errors map[string]error
+
+	// ReturnCodes contains the retcode reported by each minion
+	ReturnCodes map[string]int
+}
+
+/*
+ExitCode returns the exit code salt CLI reports for the result with --retcode-passthrough
+
+The highest retcode of the minions is returned; 2 if a state failed and 1 if a minion did not execute states
+while reporting success. Returns 0 if all minions executed their states successfully.
+*/
+func (r *StateResult) ExitCode() int {
+	if code := exitCode(r.ReturnCodes); code != 0 {
+		return code
+	}
+
+	for _, states := range r.States {
+		for _, s := range states {
+			if s.Result != nil && !*s.Result {
+				return 2
+			}
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+/*
+StateApply applies the SLS files of mods on targeted minions with state.apply, or their highstate if mods is empty
+
+kwargs are passed to state.apply, such as {"test": true} or {"pillar": {...}}.
+Minions whose SLS files failed to render are reported with *RenderError in Errors.
+Minions which did not respond are not included.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.state.html#salt.modules.state.apply_
+*/
+func (c *Client) StateApply(ctx context.Context, target Target, mods []string, kwargs map[string]interface{}) (*StateResult, error) {
+	var arg []interface{}
+	if len(mods) > 0 {
+		arg = []interface{}{strings.Join(mods, ",")}
+	}
+
+	return c.runState(ctx, target, "state.apply", arg, kwargs)
+}
+
+/*
+StateChange is a change a state would make, as reported by states executed with test=True
+
+Item is set if the state reports several changes, e.g. the package name for pkg states or diff for file states;
+OldValue is nil for changes reported without the old value, such as diffs.
+*/
+type StateChange struct {
+	Minion string
+
+	// StateID is the key of the state in StateResult.States (e.g.: pkg_|-nginx_|-nginx_|-installed)
+	StateID  string
+	Item     string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+/*
+PlannedChanges returns the changes of states which would make changes, i.e. executed with test=True
+
+Changes are sorted by minion and by execution order of the states; states which were executed are not included.
+*/
+func (r *StateResult) PlannedChanges() []StateChange {
+	var changes []StateChange
+	for minion, states := range r.States {
+		for key, s := range states {
+			if s.Result != nil || len(s.Changes) == 0 {
+				continue
+			}
+
+			if oldValue, newValue, ok := oldNew(s.Changes); ok {
+				changes = append(changes, StateChange{Minion: minion, StateID: key, OldValue: oldValue, NewValue: newValue})
+				continue
+			}
+
+			for item, v := range s.Changes {
+				c := StateChange{Minion: minion, StateID: key, Item: item, NewValue: v}
+				if m, ok := v.(map[string]interface{}); ok {
+					if oldValue, newValue, ok := oldNew(m); ok {
+						c.OldValue, c.NewValue = oldValue, newValue
+					}
+				}
+
+				changes = append(changes, c)
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Minion != b.Minion {
+			return a.Minion < b.Minion
+		}
+
+		if ra, rb := r.States[a.Minion][a.StateID].RunNum, r.States[b.Minion][b.StateID].RunNum; ra != rb {
+			return ra < rb
+		}
+
+		if a.StateID != b.StateID {
+			return a.StateID < b.StateID
+		}
+
+		return a.Item < b.Item
+	})
+
+	return changes
+}
+
+// oldNew returns the values of a change reported as {"old": ..., "new": ...}
+func oldNew(change map[string]interface{}) (interface{}, interface{}, bool) {
+	for k := range change {
+		if k != "old" && k != "new" {
+			return nil, nil, false
+		}
+	}
+
+	return change["old"], change["new"], len(change) > 0
+}
+
+// requisiteFailed prefixes comments of states which were not executed because their requisites failed
+const requisiteFailed = "One or more requisite failed: "
+
+/*
+RootCause returns the failed states which caused the other states to fail through their requisites
+
+Salt reports states whose requisites failed with the failed requisites in their comment, as sls.id of each.
+The requisites are followed until states which failed on their own; those are returned, sorted by minion and
+by execution order. Failed states without failed requisites, or whose failed requisites are not among the states,
+are their own root cause.
+*/
+func (r *StateResult) RootCause() []StateID {
+	var causes []StateID
+	for minion, states := range r.States {
+		// states by sls.id; several states can share an id declaration
+		declared := make(map[string][]string)
+		for key, s := range states {
+			declared[s.SLS+"."+s.ID] = append(declared[s.SLS+"."+s.ID], key)
+		}
+
+		visited := make(map[string]bool)
+		var walk func(key string)
+		walk = func(key string) {
+			if visited[key] {
+				return
+			}
+			visited[key] = true
+
+			s := states[key]
+			if !strings.HasPrefix(s.Comment, requisiteFailed) {
+				causes = append(causes, StateID{Minion: minion, Key: key})
+				return
+			}
+
+			found := false
+			for _, req := range strings.Split(strings.TrimPrefix(s.Comment, requisiteFailed), ", ") {
+				for _, k := range declared[strings.TrimSpace(req)] {
+					if rs := states[k]; rs.Result != nil && !*rs.Result {
+						found = true
+						walk(k)
+					}
+				}
+			}
+
+			// requisites which are not among the returned states can not be followed
+			if !found {
+				causes = append(causes, StateID{Minion: minion, Key: key})
+			}
+		}
+
+		for key, s := range states {
+			if s.Result != nil && !*s.Result {
+				walk(key)
+			}
+		}
+	}
+
+	sort.Slice(causes, func(i, j int) bool {
+		a, b := causes[i], causes[j]
+		if a.Minion != b.Minion {
+			return a.Minion < b.Minion
+		}
+
+		return r.States[a.Minion][a.Key].RunNum < r.States[b.Minion][b.Key].RunNum
+	})
+
+	return causes
+}
+
+/*
+StateSingle executes a single state on targeted minions with state.single
+
+fun is the state function (e.g.: pkg.installed), name is the name argument of the state and
+kwargs are the arguments of the state; e.g. {"test": true} to see the changes without applying them.
+Minions which did not respond are not included.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.state.html#salt.modules.state.single
+*/
+func (c *Client) StateSingle(ctx context.Context, target Target, fun string, name string, kwargs map[string]interface{}) (*StateResult, error) {
+	return c.runState(ctx, target, "state.single", []interface{}{fun, name}, kwargs)
+}
+
+/*
+StateHigh executes states described by high data on targeted minions with state.high
+
+data is keyed by state id, each id containing the state module with its function and arguments, e.g.:
+
+	{"nginx": {"pkg": ["installed", {"version": "1.18.0"}]}}
+
+kwargs are passed to state.high, such as {"test": true}.
+Minions which did not respond are not included.
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.state.html#salt.modules.state.high
+*/
+func (c *Client) StateHigh(ctx context.Context, target Target, data map[string]interface{}, kwargs map[string]interface{}) (*StateResult, error) {
+	kwarg := make(map[string]interface{}, len(kwargs)+1)
+	for k, v := range kwargs {
+		kwarg[k] = v
+	}
+	kwarg["data"] = data
+
+	return c.runState(ctx, target, "state.high", nil, kwarg)
+}
+
+// runState executes a state function and decodes the state returns per minion
+func (c *Client) runState(ctx context.Context, target Target, fun string, arg []interface{}, kwarg map[string]interface{}) (*StateResult, error) {
+	if concurrentStates(ctx) {
+		if _, ok := kwarg["concurrent"]; !ok {
+			merged := make(map[string]interface{}, len(kwarg)+1)
+			for k, v := range kwarg {
+				merged[k] = v
+			}
+			merged["concurrent"] = true
+			kwarg = merged
+		}
+	}
+
+	res, err := c.runLocal(ctx, target, fun, arg, kwarg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StateResult{
+		States:      make(map[string]map[string]StateReturn, len(res)),
+		Errors:      make(map[string]error),
+		ReturnCodes: make(map[string]int, len(res)),
+	}
+
+	for k, r := range res {
+		result.ReturnCodes[k] = r.ReturnCode
+
+		var states map[string]StateReturn
+		if err := json.Unmarshal(r.Return, &states); err != nil {
+			if message, ok := renderFailure(r.Return); ok {
+				result.Errors[k] = &RenderError{Minion: k, Message: message}
+			} else {
+				result.Errors[k] = fmt.Errorf("%s: %w: %s", fun, ErrorCommandFailed, r.Return)
+			}
+			continue
+		}
+
+		result.States[k] = states
+	}
+
+	return result, nil
+}
+
+/*
+renderFailure returns the messages of a return reporting SLS files which failed to render
+
+States which could not be compiled are returned as a list of messages instead of states; those of SLS files
+failing to render start with "Rendering SLS", others such as unavailable states or SLS files are not reported.
+*/
+func renderFailure(ret json.RawMessage) (string, bool) {
+	var messages []string
+	if err := json.Unmarshal(ret, &messages); err != nil {
+		return "", false
+	}
+
+	var failures []string
+	for _, m := range messages {
+		if strings.HasPrefix(m, "Rendering SLS ") {
+			failures = append(failures, m)
+		}
+	}
+
+	return strings.Join(failures, "\n"), len(failures) > 0
+}
@@ -0,0 +1,165 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateApply(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_state_apply")
+
+	res, err := c.StateApply(context.Background(), ExpressionTarget{Expression: "web*", Type: Glob}, []string{"nginx", "nginx.conf"}, nil)
+
+	assert.NoError(t, err)
+	s := res.States["web1"]["file_|-nginx_conf_|-/etc/nginx/nginx.conf_|-managed"]
+	assert.True(t, *s.Result)
+	assert.Equal(t, 1, s.RunNum)
+
+	var rerr *RenderError
+	assert.True(t, errors.As(res.Errors["web2"], &rerr))
+	assert.True(t, errors.Is(res.Errors["web2"], ErrorCommandFailed))
+	assert.Equal(t, "web2", rerr.Minion)
+	assert.Contains(t, rerr.Message, "Rendering SLS 'base:nginx.conf' failed: Jinja syntax error")
+	assert.NotContains(t, res.States, "web2")
+
+	assert.True(t, errors.Is(res.Errors["web3"], ErrorCommandFailed))
+	assert.False(t, errors.As(res.Errors["web3"], &rerr))
+	assert.Equal(t, 1, res.ExitCode())
+}
+
+func TestStateResultPlannedChanges(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_state_apply_test")
+
+	res, err := c.StateApply(context.Background(), ExpressionTarget{Expression: "web1", Type: Glob}, []string{"nginx"}, map[string]interface{}{"test": true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []StateChange{
+		{
+			Minion:   "web1",
+			StateID:  "pkg_|-nginx_|-nginx_|-latest",
+			Item:     "nginx",
+			OldValue: "1.18.0-0ubuntu1",
+			NewValue: "1.18.0-0ubuntu1.2",
+		},
+		{
+			Minion:   "web1",
+			StateID:  "file_|-nginx_conf_|-/etc/nginx/nginx.conf_|-managed",
+			Item:     "diff",
+			NewValue: "---\n+++\n@@ -1 +1 @@\n-worker_processes 2;\n+worker_processes 4;\n",
+		},
+		{
+			Minion:   "web1",
+			StateID:  "file_|-nginx_conf_|-/etc/nginx/nginx.conf_|-managed",
+			Item:     "mode",
+			NewValue: "0640",
+		},
+		{
+			Minion:   "web1",
+			StateID:  "sysctl_|-somaxconn_|-net.core.somaxconn_|-present",
+			OldValue: "128",
+			NewValue: "4096",
+		},
+	}, res.PlannedChanges())
+}
+
+func TestStateResultRootCause(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_state_apply_requisites")
+
+	res, err := c.StateApply(context.Background(), ExpressionTarget{Expression: "web1", Type: Glob}, nil, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "nginx_conf", res.States["web1"]["file_|-nginx_conf_|-/etc/nginx/nginx.conf_|-managed"].ID)
+	assert.Equal(t, []StateID{
+		{Minion: "web1", Key: "pkg_|-nginx_|-nginx_|-installed"},
+		{Minion: "web1", Key: "cron_|-logrotate_|-/usr/sbin/logrotate /etc/logrotate.conf_|-present"},
+	}, res.RootCause())
+	assert.Equal(t, 2, res.ExitCode())
+}
+
+func TestStateResultRootCauseOfUnknownRequisite(t *testing.T) {
+	failed := false
+	res := &StateResult{
+		States: map[string]map[string]StateReturn{
+			"minion1": {
+				"service_|-nginx_|-nginx_|-running": {Result: &failed, Comment: "One or more requisite failed: nginx.nginx"},
+			},
+		},
+	}
+
+	assert.Equal(t, []StateID{{Minion: "minion1", Key: "service_|-nginx_|-nginx_|-running"}}, res.RootCause())
+}
+
+func TestStateSingle(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_state_single")
+
+	res, err := c.StateSingle(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "pkg.installed", "nginx", map[string]interface{}{"version": "1.18.0"})
+
+	assert.NoError(t, err)
+	s := res.States["minion1"]["pkg_|-nginx_|-nginx_|-installed"]
+	assert.Equal(t, "nginx", s.Name)
+	assert.True(t, *s.Result)
+	assert.NotEmpty(t, s.Changes["nginx"])
+	assert.True(t, errors.Is(res.Errors["minion3"], ErrorCommandFailed))
+	var rerr *RenderError
+	assert.False(t, errors.As(res.Errors["minion3"], &rerr))
+	assert.NotContains(t, res.States, "minion3")
+	assert.Equal(t, 1, res.ExitCode())
+}
+
+func TestStateHigh(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_state_high")
+
+	data := map[string]interface{}{
+		"nginx": map[string]interface{}{"pkg": []interface{}{"installed"}},
+	}
+	res, err := c.StateHigh(context.Background(), ExpressionTarget{Expression: "minion1", Type: Glob}, data, map[string]interface{}{"test": true})
+
+	assert.NoError(t, err)
+	assert.Nil(t, res.States["minion1"]["pkg_|-nginx_|-nginx_|-installed"].Result)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, 0, res.ExitCode())
+}
+
+func TestStateHighConcurrent(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_state_high_concurrent")
+
+	data := map[string]interface{}{
+		"nginx": map[string]interface{}{"pkg": []interface{}{"installed"}},
+	}
+	kwargs := map[string]interface{}{"test": true}
+	res, err := c.StateHigh(WithConcurrentStates(context.Background()), ExpressionTarget{Expression: "minion1", Type: Glob}, data, kwargs)
+
+	assert.NoError(t, err)
+	assert.Contains(t, res.States, "minion1")
+	assert.Equal(t, map[string]interface{}{"test": true}, kwargs)
+}
+
+func TestStateResultExitCode(t *testing.T) {
+	failed := false
+	res := &StateResult{
+		States: map[string]map[string]StateReturn{
+			"minion1": {"pkg_|-nginx_|-nginx_|-installed": {Result: &failed}},
+		},
+		ReturnCodes: map[string]int{"minion1": 0},
+	}
+
+	assert.Equal(t, 2, res.ExitCode())
+
+	res.ReturnCodes["minion2"] = 5
+	assert.Equal(t, 5, res.ExitCode())
+}
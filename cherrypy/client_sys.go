@@ -0,0 +1,51 @@
+package cherrypy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// MinionFunctions contains the functions available per minion
+type MinionFunctions struct {
+	Functions map[string][]string
+
+	// Errors contains minions failing the command; minions which did not respond are not included in either
+	Errors map[string]error
+}
+
+/*
+ListFunctions retrieves functions available on targeted minions with sys.list_functions
+
+Functions can be limited to certain modules by passing module names, globs are supported (e.g.: "sys", "pkg*").
+
+https://docs.saltstack.com/en/latest/ref/modules/all/salt.modules.sysmod.html#salt.modules.sysmod.list_functions
+*/
+func (c *Client) ListFunctions(ctx context.Context, target Target, modules ...string) (*MinionFunctions, error) {
+	args := make([]interface{}, len(modules))
+	for i, m := range modules {
+		args[i] = m
+	}
+
+	res, err := c.runLocal(ctx, target, "sys.list_functions", args, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MinionFunctions{
+		Functions: make(map[string][]string),
+		Errors:    make(map[string]error),
+	}
+
+	for k, r := range res {
+		var f []string
+		if r.ReturnCode != 0 || json.Unmarshal(r.Return, &f) != nil {
+			result.Errors[k] = fmt.Errorf("sys.list_functions: %w: %s", ErrorCommandFailed, r.Return)
+			continue
+		}
+
+		result.Functions[k] = f
+	}
+
+	return result, nil
+}
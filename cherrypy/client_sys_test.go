@@ -0,0 +1,24 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListFunctions(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_sys_list_functions")
+
+	res, err := c.ListFunctions(context.Background(), ExpressionTarget{Expression: "minion*", Type: Glob}, "test")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(res.Functions))
+	assert.Equal(t, []string{"test.echo", "test.ping", "test.version"}, res.Functions["minion1"])
+	assert.Equal(t, []string{"test.echo", "test.ping"}, res.Functions["minion2"])
+	assert.Equal(t, 1, len(res.Errors))
+	assert.True(t, errors.Is(res.Errors["minion3"], ErrorCommandFailed))
+}
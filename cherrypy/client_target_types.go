@@ -1,5 +1,7 @@
 package cherrypy
 
+import "fmt"
+
 /*
 TargetType indicates Salt API which targing mode to use.
 
@@ -55,6 +57,83 @@ type Target interface {
 	GetType() TargetType
 }
 
+// delimitedTarget is implemented by targets which may override the delimiter of grain and pillar matching
+type delimitedTarget interface {
+	GetDelimiter() string
+}
+
+// targetDelimiter returns the delimiter override of t, if any
+func targetDelimiter(t Target) string {
+	if d, ok := t.(delimitedTarget); ok {
+		return d.GetDelimiter()
+	}
+
+	return ""
+}
+
+// targetJSON is the wire format of a Target
+type targetJSON struct {
+	Target     interface{} `json:"tgt,omitempty"`
+	TargetType string      `json:"tgt_type,omitempty"`
+	Delimiter  string      `json:"delimiter,omitempty"`
+}
+
+func newTargetJSON(t Target) targetJSON {
+	if t == nil {
+		return targetJSON{}
+	}
+
+	return targetJSON{
+		Target:     t.GetTarget(),
+		TargetType: string(t.GetType()),
+		Delimiter:  targetDelimiter(t),
+	}
+}
+
+// parse returns the Target encoded in t or nil if there is none
+func (t targetJSON) parse() (Target, error) {
+	if t.Target == nil {
+		return nil, nil
+	}
+
+	target, err := parseTarget(t.Target, t.TargetType)
+	if err != nil {
+		return nil, err
+	}
+
+	if e, ok := target.(*ExpressionTarget); ok {
+		e.Delimiter = t.Delimiter
+	}
+
+	return target, nil
+}
+
+// parseTarget creates a Target from tgt and tgt_type values received from Salt
+func parseTarget(target interface{}, targetType string) (Target, error) {
+	tt, ok := targetTypes[targetType]
+	if !ok {
+		tt = TargetType(targetType)
+	}
+
+	if t, ok := target.([]interface{}); ok && tt == List {
+		targets, err := stringSlice(t)
+		if err != nil {
+			return nil, fmt.Errorf("tgt: %w", err)
+		}
+
+		return &ListTarget{
+			Targets: targets,
+		}, nil
+	}
+
+	// Runner and wheel jobs may not have a target
+	expr, _ := target.(string)
+	return &ExpressionTarget{
+		Expression: expr,
+		Type:       tt,
+	}, nil
+}
+
 // ListTarget is for list target type of SaltStack
 type ListTarget struct {
 	// Targets contain list of minion ids
@@ -75,6 +154,10 @@ func (t ListTarget) GetType() TargetType {
 type ExpressionTarget struct {
 	Expression string
 	Type       TargetType
+
+	// Delimiter overrides ":" separating keys and values in grain and pillar matching,
+	// e.g. for matching grains with IPv6 addresses. Empty uses the default.
+	Delimiter string
 }
 
 // GetTarget returns targets
@@ -86,3 +169,8 @@ func (t ExpressionTarget) GetTarget() interface{} {
 func (t ExpressionTarget) GetType() TargetType {
 	return t.Type
 }
+
+// GetDelimiter returns the delimiter of grain and pillar matching
+func (t ExpressionTarget) GetDelimiter() string {
+	return t.Delimiter
+}
@@ -29,8 +29,17 @@ func setup(t *testing.T) (*apiTester.Tester, *Client) {
 		t.Fatal(err)
 	}
 
-	client := NewClient(tester.URL, testUsername, testPassword, testEAuth, false)
+	client := newClient(t, tester)
 	client.Token = testToken
 
 	return tester, client
 }
+
+func newClient(t *testing.T, tester *apiTester.Tester, opts ...ClientOption) *Client {
+	client, err := NewClient(tester.URL, testUsername, testPassword, testEAuth, false, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
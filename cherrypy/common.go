@@ -1,6 +1,7 @@
 package cherrypy
 
 import (
+	"encoding/json"
 	"strconv"
 	"strings"
 	"time"
@@ -37,3 +38,22 @@ func (t *saltTime) UnmarshalJSON(input []byte) error {
 	t.Time = v
 	return nil
 }
+
+// saltSeconds converts d to seconds as Salt expects durations, keeping fractions of a second
+func saltSeconds(d time.Duration) json.Number {
+	return json.Number(strconv.FormatFloat(d.Seconds(), 'f', -1, 64))
+}
+
+// parseSaltSeconds converts seconds sent to Salt back to a duration; empty n is zero
+func parseSaltSeconds(n json.Number) (time.Duration, error) {
+	if n == "" {
+		return 0, nil
+	}
+
+	s, err := n.Float64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(s * float64(time.Second)), nil
+}
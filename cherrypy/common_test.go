@@ -0,0 +1,26 @@
+package cherrypy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaltSeconds(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                       "0",
+		time.Nanosecond:         "0.000000001",
+		250 * time.Millisecond:  "0.25",
+		1500 * time.Millisecond: "1.5",
+		30 * time.Second:        "30",
+		90 * 24 * time.Hour:     "7776000",
+	}
+
+	for d, want := range cases {
+		b, err := json.Marshal(saltSeconds(d))
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(b), d.String())
+	}
+}
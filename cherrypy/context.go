@@ -0,0 +1,192 @@
+package cherrypy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type contextKey string
+
+const (
+	requestIDKey  contextKey = "request-id"
+	kwargsKey     contextKey = "kwargs"
+	insecureKey   contextKey = "insecure-skip-verify"
+	idemKey       contextKey = "idempotency-key"
+	concurrentKey contextKey = "concurrent-states"
+	retriesKey    contextKey = "retries"
+
+	// requestIDHeader carries the correlation id of each request
+	requestIDHeader = "X-Request-ID"
+
+	// idempotencyKeyHeader carries the idempotency key of hook requests
+	idempotencyKeyHeader = "Idempotency-Key"
+)
+
+/*
+WithRequestID returns a copy of ctx carrying a correlation id for the requests made with it
+
+The id is sent in X-Request-ID header and included in debug logs.
+If ctx does not carry an id; a random one is generated for each request.
+*/
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the correlation id carried by ctx
+func RequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok && id != ""
+}
+
+/*
+WithKwargs returns a copy of ctx carrying keyword arguments to be added to commands executed on minions with it
+
+Applies to local commands, MinionJob and helpers of the client; keyword arguments passed explicitly take precedence.
+Called functions must accept the keyword arguments, e.g. with **kwargs.
+*/
+func WithKwargs(ctx context.Context, kwargs map[string]interface{}) context.Context {
+	return context.WithValue(ctx, kwargsKey, kwargs)
+}
+
+// Kwargs returns keyword arguments carried by ctx
+func Kwargs(ctx context.Context) map[string]interface{} {
+	kwargs, _ := ctx.Value(kwargsKey).(map[string]interface{})
+	return kwargs
+}
+
+// mergeKwargs returns kwarg with keyword arguments carried by ctx added; kwarg is not modified
+func mergeKwargs(ctx context.Context, kwarg map[string]interface{}) map[string]interface{} {
+	defaults := Kwargs(ctx)
+	if len(defaults) == 0 {
+		return kwarg
+	}
+
+	merged := make(map[string]interface{}, len(defaults)+len(kwarg))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+
+	for k, v := range kwarg {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+/*
+WithConcurrentStates returns a copy of ctx allowing state helpers called with it to run while other states are running
+
+Sends concurrent keyword argument to state functions such as StateSingle() and StateHigh(), unless set explicitly.
+Salt refuses overlapping state runs by default as they can conflict; enable it only for states safe to run concurrently.
+*/
+func WithConcurrentStates(ctx context.Context) context.Context {
+	return context.WithValue(ctx, concurrentKey, true)
+}
+
+func concurrentStates(ctx context.Context) bool {
+	concurrent, _ := ctx.Value(concurrentKey).(bool)
+	return concurrent
+}
+
+/*
+WithRetries returns a copy of ctx re-running local commands executed with it on minions which failed or did not return
+
+Commands are re-run up to retries times against a ListTarget of those minions only, e.g. for functions failing
+intermittently on a few minions; the returns of the attempts are merged, each minion keeping its latest return.
+Applies to RunLocal() and the helpers executing functions on minions synchronously. Minions fail with a non-zero
+retcode; only retry functions which are safe to execute again on minions which might have applied them already.
+*/
+func WithRetries(ctx context.Context, retries int) context.Context {
+	return context.WithValue(ctx, retriesKey, retries)
+}
+
+func retries(ctx context.Context) int {
+	n, _ := ctx.Value(retriesKey).(int)
+	return n
+}
+
+/*
+WithIdempotencyKey returns a copy of ctx carrying a key to identify repeated attempts of the same hook request
+
+The key is sent in Idempotency-Key header by Hook(); retries of a request should reuse ctx so that the reactor
+receives the same key for each attempt, see Hook().
+*/
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idemKey, key)
+}
+
+// IdempotencyKey returns the idempotency key carried by ctx
+func IdempotencyKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idemKey).(string)
+	return key, ok && key != ""
+}
+
+/*
+WithInsecureSkipVerify returns a copy of ctx disabling verification of the server certificate for the requests made with it
+
+This exposes the requests, including credentials and tokens, to man-in-the-middle attacks; use it only for
+masters with certificates which can not be verified otherwise, and prefer WithRootCAFile() where possible.
+Verification is only skipped for the address of the client; redirects to other origins are refused.
+*/
+func WithInsecureSkipVerify(ctx context.Context) context.Context {
+	return context.WithValue(ctx, insecureKey, true)
+}
+
+func insecureSkipVerify(ctx context.Context) bool {
+	insecure, _ := ctx.Value(insecureKey).(bool)
+	return insecure
+}
+
+func requestID(ctx context.Context) (string, error) {
+	if id, ok := RequestID(ctx); ok {
+		return id, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+/*
+RequestGroup cancels the requests of a common owner together, such as a user session
+
+Requests join the group by using a context derived with Context.
+*/
+type RequestGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRequestGroup creates a new request group
+func NewRequestGroup() *RequestGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RequestGroup{ctx: ctx, cancel: cancel}
+}
+
+/*
+Context returns a copy of parent which is cancelled when the group is cancelled
+
+Contexts derived after the group is cancelled are cancelled immediately.
+The returned cancel function should be called when the requests made with the context complete.
+*/
+func (g *RequestGroup) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-g.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// Cancel aborts all in-flight requests of the group
+func (g *RequestGroup) Cancel() {
+	g.cancel()
+}
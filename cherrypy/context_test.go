@@ -0,0 +1,80 @@
+package cherrypy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	apiTester "github.com/finarfin/go-apiclient-tester/tester"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("stats", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		ids = append(ids, req.Header.Get("X-Request-ID"))
+		apiTester.WriteResponse(t, &s.Response, w)
+	})
+
+	_, err = c.Stats(WithRequestID(context.Background(), "test-request-id"))
+	assert.NoError(t, err)
+	_, err = c.Stats(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(ids))
+	assert.Equal(t, "test-request-id", ids[0])
+	assert.NotEmpty(t, ids[1])
+}
+
+func TestRequestGroupCancel(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	s, err := tester.Scenario("stats", "success")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewRequestGroup()
+	tester.Do(s.Request.Path, func(w http.ResponseWriter, req *http.Request) {
+		g.Cancel()
+		<-req.Context().Done()
+	})
+
+	ctx, cancel := g.Context(context.Background())
+	defer cancel()
+
+	_, err = c.Stats(ctx)
+
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	ctx, cancel = g.Context(context.Background())
+	defer cancel()
+	<-ctx.Done()
+}
+
+func TestKwargs(t *testing.T) {
+	tester, c := setup(t)
+	defer tester.Close()
+	tester.Setup(t, "run", "local_context_kwargs")
+
+	ctx := WithKwargs(context.Background(), map[string]interface{}{"requested_by": "ui", "color": "blue"})
+	kwarg := map[string]interface{}{"color": "red"}
+
+	_, err := c.RunCommand(ctx, Command{
+		Client:    LocalClient,
+		Target:    ExpressionTarget{Expression: "minion1", Type: Glob},
+		Function:  "test.arg",
+		Arguments: map[string]interface{}{"kwarg": kwarg},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"color": "red"}, kwarg)
+}
@@ -1,10 +1,153 @@
 package cherrypy
 
-func stringSlice(raw []interface{}) []string {
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// stringSlice converts raw into strings, failing on the first value which is not a string
+func stringSlice(raw []interface{}) ([]string, error) {
 	x := make([]string, len(raw))
 	for i, v := range raw {
-		x[i] = v.(string)
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %T value %v at index %d, expected string", v, v, i)
+		}
+
+		x[i] = s
+	}
+
+	return x, nil
+}
+
+// legacyArgs appends kwargs to args as "key=value" strings
+func legacyArgs(args []interface{}, kwargs map[string]interface{}) ([]interface{}, error) {
+	keys := make([]string, 0, len(kwargs))
+	for k := range kwargs {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	res := make([]interface{}, len(args), len(args)+len(keys))
+	copy(res, args)
+	for _, k := range keys {
+		v, ok := kwargs[k].(string)
+		if !ok {
+			b, err := json.Marshal(kwargs[k])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+
+			v = string(b)
+		}
+
+		res = append(res, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	return res, nil
+}
+
+// expectDelim reads the next token and fails unless it is the delimiter d
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if t != d {
+		return fmt.Errorf("unexpected token %v, expected %v", t, d)
+	}
+
+	return nil
+}
+
+// skipValue reads the next value without keeping it in memory
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// detachedContext carries values of its parent but is never cancelled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// redactPassword replaces password fields of a JSON or form encoded request body for logging
+func redactPassword(body []byte) []byte {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return body
+	}
+
+	var d interface{}
+	if err := json.Unmarshal(body, &d); err != nil {
+		q, err := url.ParseQuery(string(body))
+		if err != nil {
+			return []byte("<unparsable body>")
+		}
+
+		if _, ok := q["password"]; ok {
+			q.Set("password", "<redacted>")
+		}
+
+		return []byte(q.Encode())
+	}
+
+	objects, ok := d.([]interface{})
+	if !ok {
+		objects = []interface{}{d}
+	}
+
+	for _, o := range objects {
+		if m, ok := o.(map[string]interface{}); ok {
+			if _, ok := m["password"]; ok {
+				m["password"] = "<redacted>"
+			}
+		}
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return []byte("<unparsable body>")
 	}
 
-	return x
+	return b
 }